@@ -0,0 +1,245 @@
+package mistclient
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DefaultSubscriptionBuffer is the number of messages queued for each subscription awaiting delivery to a
+// subscriber, unless set with WithBuffer.
+const DefaultSubscriptionBuffer = 64
+
+// OverflowPolicy determines what happens to a message received for a subscription whose buffer is full
+// because the subscriber is not keeping up.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for the subscriber to make room, holding back every other channel sharing the
+	// connection meanwhile. Time spent waiting does not count towards the idle timeout, so a connection held
+	// back by a slow subscriber is not mistaken for a stale one, but should the subscriber fall far enough
+	// behind, Mist may close the connection.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest buffered message to make room for the new one.
+	OverflowDropOldest
+	// OverflowDropNewest discards the new message, keeping those already buffered.
+	OverflowDropNewest
+	// OverflowCoalesce keeps only the latest of the buffered messages with the same key, as determined by
+	// the function set with WithCoalesceKey. A message replaces a buffered message with the same key in
+	// place, whether or not the buffer is full. Should the buffer fill with messages for distinct keys, the
+	// oldest is discarded.
+	OverflowCoalesce
+)
+
+// String returns the name of the policy.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowCoalesce:
+		return "coalesce"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+	}
+}
+
+// WithBuffer sets the number of messages buffered for each subscription awaiting delivery. A size below 1
+// is treated as 1.
+func WithBuffer(size int) SubscribeOption {
+	return func(so *subscribeOptions) {
+		so.buffer = max(size, 1)
+	}
+}
+
+// WithOverflowPolicy sets what happens to messages received for a subscription whose buffer is full.
+// Messages discarded as a result are counted by Subscription.Dropped and the IncMessagesDropped metric.
+func WithOverflowPolicy(policy OverflowPolicy) SubscribeOption {
+	return func(so *subscribeOptions) {
+		so.overflow = policy
+	}
+}
+
+// WithCoalesceKey sets the function determining the key by which messages are coalesced under
+// OverflowCoalesce, such as KeyByJSONField("mac"). Messages with an empty key are never coalesced. Without a
+// key function, only the latest buffered message for each channel is kept.
+func WithCoalesceKey(key func(WebsocketMessage) string) SubscribeOption {
+	return func(so *subscribeOptions) {
+		so.coalesceKey = key
+	}
+}
+
+// KeyByJSONField returns a coalesce key function taking the key from a top-level field of the JSON object
+// in a message's data, such as the "mac" of a device stat. Messages whose data is not a JSON object, or
+// which lack the field, have an empty key.
+func KeyByJSONField(field string) func(WebsocketMessage) string {
+	return func(msg WebsocketMessage) string {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(msg.Data), &fields); err != nil {
+			return ""
+		}
+		raw, ok := fields[field]
+		if !ok {
+			return ""
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return s
+		}
+		return string(raw)
+	}
+}
+
+// queued is a message buffered for delivery to a subscriber.
+type queued struct {
+	key string
+	msg WebsocketMessage
+}
+
+// key returns the key by which a message is coalesced, and whether it is to be coalesced at all.
+func (so *subscribeOptions) key(msg WebsocketMessage) (string, bool) {
+	if so.overflow != OverflowCoalesce {
+		return "", false
+	}
+	if so.coalesceKey == nil {
+		return msg.Channel, true
+	}
+	key := so.coalesceKey(msg)
+	return key, key != ""
+}
+
+// deliver buffers a message for delivery to the subscriber, applying the session's overflow policy should
+// the buffer be full, unless the subscription ends first.
+func (sub *channelSub) deliver(msg WebsocketMessage) {
+	recordMessage(sub.span, msg)
+	so := &sub.s.so
+	key, coalesce := so.key(msg)
+
+	sub.mu.Lock()
+	for {
+		if sub.ended {
+			// The subscriber has gone away, so the message can no longer be delivered.
+			sub.mu.Unlock()
+			sub.discard(1)
+			return
+		}
+
+		if coalesce {
+			if q := sub.keys[key]; q != nil {
+				q.msg = msg
+				sub.mu.Unlock()
+				sub.discard(1)
+				return
+			}
+		}
+
+		if len(sub.queue) < so.buffer {
+			break
+		}
+		if so.overflow == OverflowBlock {
+			sub.mu.Unlock()
+			sub.shard.block()
+			select {
+			case <-sub.space:
+			case <-sub.done:
+			}
+			sub.shard.unblock()
+			sub.mu.Lock()
+			continue
+		}
+		if so.overflow == OverflowDropNewest {
+			sub.mu.Unlock()
+			sub.discard(1)
+			return
+		}
+		sub.pop()
+		sub.discard(1)
+		break
+	}
+
+	q := &queued{key: key, msg: msg}
+	sub.queue = append(sub.queue, q)
+	if coalesce {
+		sub.keys[key] = q
+	}
+	sub.mu.Unlock()
+	signal(sub.ready)
+}
+
+// pop removes and returns the oldest buffered message. The caller must hold sub.mu.
+func (sub *channelSub) pop() *queued {
+	q := sub.queue[0]
+	sub.queue[0] = nil
+	sub.queue = sub.queue[1:]
+	if sub.keys[q.key] == q {
+		delete(sub.keys, q.key)
+	}
+	return q
+}
+
+// pump sends buffered messages to the subscriber, closing its Go channel once the subscription has ended
+// and the buffer has been emptied. Should the subscription be closed or unsubscribed, or the session's
+// context be done, the subscriber may no longer be receiving, so messages still buffered are delivered only
+// if it is waiting for them, and otherwise discarded.
+func (sub *channelSub) pump() {
+	defer close(sub.ch)
+
+	for {
+		sub.mu.Lock()
+		for len(sub.queue) == 0 {
+			if sub.ended {
+				sub.mu.Unlock()
+				return
+			}
+			sub.mu.Unlock()
+			<-sub.ready
+			sub.mu.Lock()
+		}
+		q := sub.pop()
+		sub.mu.Unlock()
+		signal(sub.space)
+
+		select {
+		case sub.ch <- q.msg:
+			continue
+		case <-sub.abort:
+		case <-sub.s.parent.Done():
+			// Wait for the subscription to end, so that its error is recorded before its Go channel is closed.
+			<-sub.done
+		}
+
+		sub.mu.Lock()
+		rest := append([]*queued{q}, sub.queue...)
+		sub.queue = nil
+		clear(sub.keys)
+		sub.ended = true
+		sub.mu.Unlock()
+
+		for _, q := range rest {
+			select {
+			case sub.ch <- q.msg:
+			default:
+				sub.discard(1)
+			}
+		}
+		return
+	}
+}
+
+// discard counts messages dropped before delivery to the subscriber.
+func (sub *channelSub) discard(n int) {
+	sub.handle.dropped.Add(uint64(n))
+	for range n {
+		sub.s.c.metrics.IncMessagesDropped(channelTemplate(sub.channel))
+	}
+}
+
+// signal wakes a goroutine waiting on a channel of capacity one, without blocking.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,122 @@
+package mistclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testBurst subscribes to a server sending a burst of five device stats, numbered in order and alternating
+// between two MACs. If stall is set, the subscriber only starts receiving once the connection has closed. It
+// returns the messages received and the subscription.
+func testBurst(t *testing.T, m Metrics, stall bool, opts ...SubscribeOption) ([]WebsocketMessage, *Subscription[WebsocketMessage]) {
+	t.Helper()
+	var data []string
+	for i := 1; i <= 5; i++ {
+		data = append(data, fmt.Sprintf(`{"mac": "5c5b3500000%d", "n": %d}`, i%2, i))
+	}
+	s := testBurstWebsocketServer(t, data...)
+	t.Cleanup(s.Close)
+	c, err := New(&Config{BaseURL: "https://mist-proxy.example.com", WebsocketURL: "ws" + s.URL[len("http"):], APIKey: "testAPIKey"}, nil,
+		WithMetrics(m))
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	sub, err := c.Subscription(context.Background(), "/sites/test-site-id/stats/devices", opts...)
+	if err != nil {
+		t.Fatalf("APIClient.Subscription(): unexpected error: %v", err)
+	}
+	if stall {
+		waitFor(t, "the connection to close", func() bool { return sub.Err() != nil })
+	}
+
+	var msgs []WebsocketMessage
+	for msg := range sub.C {
+		msgs = append(msgs, msg)
+	}
+	if n := uint64(len(msgs)) + sub.Dropped(); n != 5 {
+		t.Errorf("Subscription: expected every message to be either received or dropped, got %d received and %d dropped", len(msgs), sub.Dropped())
+	}
+	return msgs, sub
+}
+
+// seq returns the number of a message sent by testBurst.
+func seq(t *testing.T, msg WebsocketMessage) int {
+	t.Helper()
+	var v struct {
+		N int `json:"n"`
+	}
+	if err := json.Unmarshal([]byte(msg.Data), &v); err != nil {
+		t.Fatalf("failed to decode message %q: %v", msg.Data, err)
+	}
+	return v.N
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	m := NewPrometheusMetrics()
+
+	t.Run("Drop newest", func(t *testing.T) {
+		msgs, sub := testBurst(t, m, true, WithBuffer(2), WithOverflowPolicy(OverflowDropNewest))
+		if sub.Dropped() == 0 || seq(t, msgs[0]) != 1 {
+			t.Errorf("Subscription: expected the earliest messages to be kept, got %d messages and %d dropped", len(msgs), sub.Dropped())
+		}
+		for i := 1; i < len(msgs); i++ {
+			if seq(t, msgs[i]) <= seq(t, msgs[i-1]) {
+				t.Errorf("Subscription: expected messages in order, got %d after %d", seq(t, msgs[i]), seq(t, msgs[i-1]))
+			}
+		}
+	})
+
+	t.Run("Drop oldest", func(t *testing.T) {
+		msgs, sub := testBurst(t, m, true, WithBuffer(2), WithOverflowPolicy(OverflowDropOldest))
+		if sub.Dropped() == 0 || seq(t, msgs[len(msgs)-1]) != 5 {
+			t.Errorf("Subscription: expected the latest messages to be kept, got %d messages and %d dropped", len(msgs), sub.Dropped())
+		}
+	})
+
+	t.Run("Coalesce", func(t *testing.T) {
+		msgs, sub := testBurst(t, m, true, WithBuffer(4), WithOverflowPolicy(OverflowCoalesce), WithCoalesceKey(KeyByJSONField("mac")))
+		if sub.Dropped() < 2 {
+			t.Errorf("Subscription: expected superseded messages to be dropped, got %d dropped", sub.Dropped())
+		}
+		latest := make(map[string]int)
+		for _, msg := range msgs {
+			latest[KeyByJSONField("mac")(msg)] = seq(t, msg)
+		}
+		if latest["5c5b35000001"] != 5 || latest["5c5b35000000"] != 4 {
+			t.Errorf("Subscription: expected the latest message for each MAC, got: %v", latest)
+		}
+	})
+
+	t.Run("Block", func(t *testing.T) {
+		msgs, sub := testBurst(t, m, false, WithBuffer(1))
+		if len(msgs) != 5 || sub.Dropped() != 0 {
+			t.Errorf("Subscription: expected every message to be delivered, got %d messages and %d dropped", len(msgs), sub.Dropped())
+		}
+	})
+
+	var b strings.Builder
+	m.WriteTo(&b)
+	if want := `mistclient_messages_dropped_total{channel="/sites/:site_id/stats/devices"}`; !strings.Contains(b.String(), want) {
+		t.Errorf("Metrics: expected output to contain %q, got:\n%s", want, b.String())
+	}
+}
+
+func TestKeyByJSONField(t *testing.T) {
+	key := KeyByJSONField("mac")
+	tests := map[string]string{
+		`{"mac": "5c5b35000001", "uptime": 10}`: "5c5b35000001",
+		`{"mac": 42}`:                           "42",
+		`{"uptime": 10}`:                        "",
+		`not json`:                              "",
+		`["5c5b35000001"]`:                      "",
+	}
+	for data, want := range tests {
+		if got := key(WebsocketMessage{Data: data}); got != want {
+			t.Errorf("KeyByJSONField(mac)(%s): expected %q, got: %q", data, want, got)
+		}
+	}
+}
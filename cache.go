@@ -0,0 +1,289 @@
+package mistclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CacheConfig configures the optional cache of GET responses.
+//
+// Successful responses are cached for the TTL of their endpoint, looked up in TTLs by endpoint template
+// (e.g. EndpointOrgSites) and otherwise taken from DefaultTTL. Endpoints with a zero TTL are not cached,
+// so the zero value disables the cache. Once an entry has expired it is revalidated with If-None-Match
+// if Mist supplied an ETag, and a 304 Not Modified response renews the entry without transferring it again.
+//
+// Successful POST, PUT and DELETE requests invalidate the cached responses of the path they modify and
+// of its parent, so that, for example, creating an API token invalidates the cached list of tokens.
+type CacheConfig struct {
+	DefaultTTL time.Duration            `yaml:"default_ttl,omitempty"`
+	TTLs       map[string]time.Duration `yaml:"ttls,omitempty"`
+	// MaxEntries bounds the number of cached responses, evicting those closest to expiry. Zero means no limit.
+	MaxEntries int `yaml:"max_entries,omitempty"`
+}
+
+// CacheStats is a snapshot of the response cache counters.
+type CacheStats struct {
+	// Hits is the number of requests served from the cache without contacting the API.
+	Hits int64
+	// Revalidations is the number of requests served from the cache following a 304 Not Modified response.
+	Revalidations int64
+	// Misses is the number of cacheable requests that were fetched from the API.
+	Misses int64
+	// Entries is the number of responses currently cached.
+	Entries int
+}
+
+// cacheEntry is a cached response body and its headers.
+type cacheEntry struct {
+	path    string
+	header  http.Header
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+// response returns a new HTTP response replaying the cached entry.
+func (e *cacheEntry) response() *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+	}
+}
+
+// responseCache holds cached GET responses keyed by request URI (path and query).
+type responseCache struct {
+	mu      sync.Mutex
+	config  CacheConfig
+	entries map[string]*cacheEntry
+
+	hits          int64
+	revalidations int64
+	misses        int64
+
+	now func() time.Time
+}
+
+// newResponseCache returns a response cache for the given configuration.
+func newResponseCache(config CacheConfig) *responseCache {
+	return &responseCache{
+		config:  config,
+		entries: make(map[string]*cacheEntry),
+		now:     time.Now,
+	}
+}
+
+// ttl returns the time for which responses from the given path are cached, or zero if they are not.
+func (rc *responseCache) ttl(path string) time.Duration {
+	if endpoint, _, ok := matchEndpoint(path); ok {
+		if ttl, ok := rc.config.TTLs[endpoint]; ok {
+			return ttl
+		}
+	}
+	return rc.config.DefaultTTL
+}
+
+// lookup returns the cached entry for a key, if any, and whether it is still fresh. Expired entries
+// without an ETag cannot be revalidated, so are discarded.
+func (rc *responseCache) lookup(key string) (*cacheEntry, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	e, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if rc.now().Before(e.expires) {
+		rc.hits++
+		return e, true
+	}
+	if e.etag == "" {
+		delete(rc.entries, key)
+		return nil, false
+	}
+	return e, false
+}
+
+// store caches a response body under the given key, counting a miss.
+func (rc *responseCache) store(key, path string, header http.Header, body []byte, ttl time.Duration) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.misses++
+	if _, ok := rc.entries[key]; !ok && rc.config.MaxEntries > 0 && len(rc.entries) >= rc.config.MaxEntries {
+		rc.evict()
+	}
+	rc.entries[key] = &cacheEntry{
+		path:    path,
+		header:  header.Clone(),
+		body:    body,
+		etag:    header.Get("ETag"),
+		expires: rc.now().Add(ttl),
+	}
+}
+
+// miss counts a cacheable request whose response could not be cached.
+func (rc *responseCache) miss() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.misses++
+}
+
+// renew extends the lifetime of an entry following a 304 Not Modified response, returning the renewed
+// entry. Validators sent with the 304 replace the stored ones, so that the next revalidation presents the
+// current ETag. Entries are replaced rather than modified, as a previous entry may still be replaying.
+func (rc *responseCache) renew(key string, e *cacheEntry, header http.Header, ttl time.Duration) *cacheEntry {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.revalidations++
+	renewed := &cacheEntry{
+		path:    e.path,
+		header:  e.header.Clone(),
+		body:    e.body,
+		etag:    e.etag,
+		expires: rc.now().Add(ttl),
+	}
+	for _, name := range []string{"ETag", "Last-Modified"} {
+		if v := header.Values(name); len(v) > 0 {
+			renewed.header[name] = v
+		}
+	}
+	if etag := header.Get("ETag"); etag != "" {
+		renewed.etag = etag
+	}
+	if rc.entries[key] == e {
+		rc.entries[key] = renewed
+	}
+	return renewed
+}
+
+// evict discards the entry closest to expiry. The cache lock must be held.
+func (rc *responseCache) evict() {
+	var (
+		oldest string
+		expiry time.Time
+	)
+	for key, e := range rc.entries {
+		if oldest == "" || e.expires.Before(expiry) {
+			oldest, expiry = key, e.expires
+		}
+	}
+	delete(rc.entries, oldest)
+}
+
+// invalidate discards the entries cached under each of the given keys, where a key is either a request URI
+// or a path, in which case every cached query of that path (e.g. every page of a list) is discarded.
+func (rc *responseCache) invalidate(keys ...string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	for _, key := range keys {
+		delete(rc.entries, key)
+		for k, e := range rc.entries {
+			if e.path == key {
+				delete(rc.entries, k)
+			}
+		}
+	}
+}
+
+// purge discards every cached entry.
+func (rc *responseCache) purge() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	clear(rc.entries)
+}
+
+// stats returns a snapshot of the cache counters.
+func (rc *responseCache) stats() CacheStats {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return CacheStats{
+		Hits:          rc.hits,
+		Revalidations: rc.revalidations,
+		Misses:        rc.misses,
+		Entries:       len(rc.entries),
+	}
+}
+
+// cachedGet performs a GET request through the response cache, serving fresh entries without contacting
+// the API and revalidating expired entries with If-None-Match where they carry an ETag.
+func (c *APIClient) cachedGet(ctx context.Context, u *url.URL, ttl time.Duration) (*http.Response, error) {
+	p := requestPath(u)
+	key := p
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+
+	entry, fresh := c.cache.lookup(key)
+	trace.SpanFromContext(ctx).SetAttributes(attrCacheHit.Bool(fresh))
+	if fresh {
+		c.logger.Trace("serving API response from cache", "url", u.String())
+		return entry.response(), nil
+	}
+
+	var header http.Header
+	if entry != nil {
+		header = http.Header{"If-None-Match": {entry.etag}}
+	}
+
+	resp, err := c.execute(ctx, http.MethodGet, u, nil, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		resp.Body.Close()
+		c.logger.Trace("cached API response revalidated", "url", u.String())
+		entry = c.cache.renew(key, entry, resp.Header, ttl)
+		trace.SpanFromContext(ctx).SetAttributes(attrCacheHit.Bool(true))
+		return entry.response(), nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		c.cache.miss()
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	c.cache.store(key, p, resp.Header, body, ttl)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	return resp, nil
+}
+
+// InvalidateCache discards cached responses. Each key is either the path of an endpoint, such as
+// "/api/v1/orgs/:org_id/sites" with the org ID filled in, discarding every cached page and query of it, or
+// a path with its query string, discarding only that response.
+func (c *APIClient) InvalidateCache(keys ...string) {
+	c.cache.invalidate(keys...)
+}
+
+// PurgeCache discards every cached response.
+func (c *APIClient) PurgeCache() {
+	c.cache.purge()
+}
+
+// CacheStats returns a snapshot of the response cache counters.
+func (c *APIClient) CacheStats() CacheStats {
+	return c.cache.stats()
+}
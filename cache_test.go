@@ -0,0 +1,199 @@
+package mistclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testCachingServer creates a test server that serves the org sites and site stats endpoints, tagging the
+// sites list with an ETag and answering matching If-None-Match requests with 304 Not Modified.
+func testCachingServer(t *testing.T, requests, notModified *atomic.Int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/api/v1/orgs/test-org-id/sites":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte(`[{"id": "test-site-id", "name": "Test Site"}]`))
+		case "/api/v1/sites/test-site-id/stats":
+			w.Write([]byte(`{"id": "test-site-id", "num_devices": 3}`))
+		case "/api/v1/orgs/test-org-id/sites/test-site-id":
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestResponseCache(t *testing.T) {
+	var requests, notModified atomic.Int32
+	s := testCachingServer(t, &requests, &notModified)
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil, WithCache(CacheConfig{
+		TTLs: map[string]time.Duration{EndpointOrgSites: time.Minute},
+	}))
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+	now := time.Now()
+	c.cache.now = func() time.Time { return now }
+
+	for range 3 {
+		sites, err := c.GetOrgSites("test-org-id")
+		if err != nil {
+			t.Fatalf("APIClient.GetOrgSites(): unexpected error: %v", err)
+		}
+		if len(sites) != 1 || sites[0].ID != "test-site-id" {
+			t.Fatalf("APIClient.GetOrgSites(): unexpected sites: %+v", sites)
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("APIClient.GetOrgSites(): expected 1 request within TTL, got: %d", got)
+	}
+
+	// Endpoints without a TTL are not cached.
+	for range 2 {
+		if _, err := c.GetSiteStats("test-site-id"); err != nil {
+			t.Fatalf("APIClient.GetSiteStats(): unexpected error: %v", err)
+		}
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("APIClient.GetSiteStats(): expected uncached requests, got %d requests in total", got)
+	}
+
+	// Once expired, the entry is revalidated with its ETag.
+	now = now.Add(2 * time.Minute)
+	sites, err := c.GetOrgSites("test-org-id")
+	if err != nil {
+		t.Fatalf("APIClient.GetOrgSites(): unexpected error after expiry: %v", err)
+	}
+	if len(sites) != 1 {
+		t.Errorf("APIClient.GetOrgSites(): expected cached sites after revalidation, got: %+v", sites)
+	}
+	if got := notModified.Load(); got != 1 {
+		t.Errorf("APIClient.GetOrgSites(): expected 1 conditional request, got: %d", got)
+	}
+
+	want := CacheStats{Hits: 2, Revalidations: 1, Misses: 1, Entries: 1}
+	if got := c.CacheStats(); got != want {
+		t.Errorf("APIClient.CacheStats(): expected %+v, got: %+v", want, got)
+	}
+
+	// Explicit invalidation discards every cached page of the endpoint.
+	c.InvalidateCache("/api/v1/orgs/test-org-id/sites")
+	if got := c.CacheStats().Entries; got != 0 {
+		t.Errorf("APIClient.InvalidateCache(): expected no entries, got: %d", got)
+	}
+	if _, err := c.GetOrgSites("test-org-id"); err != nil {
+		t.Fatalf("APIClient.GetOrgSites(): unexpected error after invalidation: %v", err)
+	}
+	if got := c.CacheStats().Misses; got != 2 {
+		t.Errorf("APIClient.GetOrgSites(): expected a miss after invalidation, got %d misses", got)
+	}
+
+	// A successful mutation invalidates the parent collection.
+	if _, err := c.Delete(c.baseURL.JoinPath("/api/v1/orgs/test-org-id/sites/test-site-id")); err != nil {
+		t.Fatalf("APIClient.Delete(): unexpected error: %v", err)
+	}
+	if got := c.CacheStats().Entries; got != 0 {
+		t.Errorf("APIClient.Delete(): expected the sites list to be invalidated, got %d entries", got)
+	}
+}
+
+func TestResponseCacheMaxEntries(t *testing.T) {
+	var requests, notModified atomic.Int32
+	s := testCachingServer(t, &requests, &notModified)
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey", Cache: CacheConfig{DefaultTTL: time.Minute, MaxEntries: 1}}, nil)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	if _, err := c.GetOrgSites("test-org-id"); err != nil {
+		t.Fatalf("APIClient.GetOrgSites(): unexpected error: %v", err)
+	}
+	if _, err := c.GetSiteStats("test-site-id"); err != nil {
+		t.Fatalf("APIClient.GetSiteStats(): unexpected error: %v", err)
+	}
+	if got := c.CacheStats().Entries; got != 1 {
+		t.Errorf("APIClient.CacheStats(): expected 1 entry, got: %d", got)
+	}
+}
+
+func TestCacheDisabledByDefault(t *testing.T) {
+	var requests, notModified atomic.Int32
+	s := testCachingServer(t, &requests, &notModified)
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	for range 2 {
+		if _, err := c.GetOrgSites("test-org-id"); err != nil {
+			t.Fatalf("APIClient.GetOrgSites(): unexpected error: %v", err)
+		}
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("APIClient.GetOrgSites(): expected 2 requests without a cache, got: %d", got)
+	}
+	if got := c.CacheStats(); got != (CacheStats{}) {
+		t.Errorf("APIClient.CacheStats(): expected zero stats, got: %+v", got)
+	}
+}
+
+func TestResponseCacheRevalidationUpdatesETag(t *testing.T) {
+	var conditions []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inm := r.Header.Get("If-None-Match")
+		conditions = append(conditions, inm)
+		if inm != "" {
+			// The content is unchanged, but the server has moved on to a new ETag for it.
+			w.Header().Set("ETag", fmt.Sprintf(`"v%d"`, len(conditions)))
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`[{"id": "test-site-id", "name": "Test Site"}]`))
+	}))
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey", Cache: CacheConfig{DefaultTTL: time.Minute}}, nil)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+	now := time.Now()
+	c.cache.now = func() time.Time { return now }
+
+	for range 3 {
+		sites, err := c.GetOrgSites("test-org-id")
+		if err != nil {
+			t.Fatalf("APIClient.GetOrgSites(): unexpected error: %v", err)
+		}
+		if len(sites) != 1 || sites[0].ID != "test-site-id" {
+			t.Fatalf("APIClient.GetOrgSites(): unexpected sites: %+v", sites)
+		}
+		now = now.Add(2 * time.Minute)
+	}
+
+	want := []string{"", `"v1"`, `"v2"`}
+	if strings.Join(conditions, ",") != strings.Join(want, ",") {
+		t.Errorf("APIClient.GetOrgSites(): expected If-None-Match %q, got: %q", want, conditions)
+	}
+	if got := c.CacheStats(); got.Revalidations != 2 || got.Entries != 1 {
+		t.Errorf("APIClient.CacheStats(): expected 2 revalidations of 1 entry, got: %+v", got)
+	}
+}
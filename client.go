@@ -5,11 +5,13 @@
 //
 // The client currently supports the following root endpoint:
 //   - /api/v1/self
+//   - /api/v1/self/apitokens
 //
 // The client currently supports the following Organization endpoints:
 //   - /api/v1/orgs/:org_id/sites
 //   - /api/v1/orgs/:org_id/tickets/count
 //   - /api/v1/orgs/:org_id/alarms/count
+//   - /api/v1/orgs/:org_id/apitokens
 //
 // The client currently supports the following Site endpoints:
 //   - /api/v1/sites/:site_id/stats
@@ -19,19 +21,20 @@
 package mistclient
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
+	"path"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/websocket"
 )
 
@@ -72,18 +75,59 @@ func (l *Logger) Trace(msg string, args ...any) {
 }
 
 // Config represents the API access parameters.
+//
+// The REST and websocket endpoints may be given explicitly with BaseURL and WebsocketURL, or derived from the
+// name of a Mist regional cloud (see ParseCloud). Explicit URLs take precedence over the cloud.
+//
+// Requests are authenticated with APIKey, spread across the pool of APIKey and APIKeys where several are
+// given, or, if Email is set, with a session established by logging in
+// to an admin account with Email, Password and, if two-factor authentication is enabled, TOTPSecret.
+//
+// A Config may be loaded from a YAML file and the environment with LoadConfig, or from the environment
+// alone with ConfigFromEnv. These also read the secrets named by APIKeyFile, PasswordFile and
+// TOTPSecretFile, which New itself ignores.
 type Config struct {
-	BaseURL string        `yaml:"base_url,omitempty"`
-	APIKey  string        `yaml:"api_key,omitempty"`
-	Timeout time.Duration `yaml:"timeout,omitempty"`
+	BaseURL        string          `yaml:"base_url,omitempty"`
+	WebsocketURL   string          `yaml:"websocket_url,omitempty"`
+	Cloud          string          `yaml:"cloud,omitempty"`
+	APIKey         string          `yaml:"api_key,omitempty"`
+	APIKeyFile     string          `yaml:"api_key_file,omitempty"`
+	APIKeys        []string        `yaml:"api_keys,omitempty"`
+	Email          string          `yaml:"email,omitempty"`
+	Password       string          `yaml:"password,omitempty"`
+	PasswordFile   string          `yaml:"password_file,omitempty"`
+	TOTPSecret     string          `yaml:"totp_secret,omitempty"`
+	TOTPSecretFile string          `yaml:"totp_secret_file,omitempty"`
+	Timeout        time.Duration   `yaml:"timeout,omitempty"`
+	RateLimit      RateLimitConfig `yaml:"rate_limit,omitempty"`
+	Retry          RetryPolicy     `yaml:"retry,omitempty"`
+	Cache          CacheConfig     `yaml:"cache,omitempty"`
 }
 
 // APIClient represents the API client.
 type APIClient struct {
 	baseURL *url.URL
-	apiKey  string
+	wsURL   *url.URL
+	tokens  *tokenPool
 	client  *http.Client
 	logger  *Logger
+	session *session
+	limiter *rateLimiter
+	cache   *responseCache
+	flights *flightGroup
+	handler Handler
+	metrics Metrics
+	retry   RetryPolicy
+	timeout time.Duration
+
+	userAgent          string
+	tlsConfig          *tls.Config
+	proxy              func(*http.Request) (*url.URL, error)
+	proxyConnectHeader http.Header
+	dialContext        func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
 }
 
 // SubscriptionRequest represents a websocket subscription request
@@ -109,15 +153,15 @@ type WebsocketMessage struct {
 	Data    string `json:"data"`
 }
 
-// New returns an instance of the API client.
-func New(config *Config, logger *slog.Logger) (*APIClient, error) {
+// New returns an instance of the API client, customised by any supplied options.
+func New(config *Config, logger *slog.Logger, opts ...Option) (*APIClient, error) {
 	if config == nil {
 		return nil, fmt.Errorf("config cannot be nil")
 	}
 
-	baseURL, err := url.Parse(config.BaseURL)
+	baseURL, wsURL, err := resolveEndpoints(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse base URL: %w", err)
+		return nil, err
 	}
 
 	timeout := config.Timeout
@@ -129,89 +173,276 @@ func New(config *Config, logger *slog.Logger) (*APIClient, error) {
 		logger = slog.Default()
 	}
 
-	return &APIClient{
-		baseURL: baseURL,
-		apiKey:  config.APIKey,
-		logger:  &Logger{logger.With("module", "mistclient")},
-		client: &http.Client{
-			Timeout: timeout,
-		},
-	}, nil
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	redaction := DefaultRedactionPolicy
+	if o.redaction != nil {
+		redaction = *o.redaction
+	}
+	logger = slog.New(NewRedactingHandler(logger.Handler(), redaction))
+
+	c := &APIClient{
+		baseURL:   baseURL,
+		wsURL:     wsURL,
+		tokens:    newTokenPool(append([]string{config.APIKey}, config.APIKeys...)...),
+		logger:    &Logger{logger.With("module", "mistclient")},
+		session:   &session{},
+		retry:     config.Retry,
+		timeout:   timeout,
+		userAgent: o.userAgent,
+		flights:   newFlightGroup(),
+	}
+	if o.retry != nil {
+		c.retry = *o.retry
+	}
+	cache := config.Cache
+	if o.cache != nil {
+		cache = *o.cache
+	}
+	c.cache = newResponseCache(cache)
+
+	// Mist enforces the request quota per token, so the budget grows with the size of the token pool.
+	rateLimit := config.RateLimit
+	rateLimit.RequestsPerHour *= c.tokens.size()
+	rateLimit.Burst = max(rateLimit.Burst, 1) * c.tokens.size()
+	c.limiter = newRateLimiter(rateLimit)
+	if config.Email != "" {
+		c.session.enabled.Store(true)
+		c.session.creds = Credentials{Email: config.Email, Password: config.Password, TOTPSecret: config.TOTPSecret}
+	}
+
+	if err := c.configureTransport(&o); err != nil {
+		return nil, err
+	}
+	c.configureTracing(&o)
+	c.metrics = o.metrics
+	if c.metrics == nil {
+		c.metrics = noopMetrics{}
+	}
+	c.handler = c.buildHandler(o.middleware)
+
+	return c, nil
+}
+
+// resolveEndpoints determines the REST and websocket URLs from the explicit URLs and cloud name in the config.
+// A nil websocket URL is returned if it is to be derived from the REST URL.
+func resolveEndpoints(config *Config) (*url.URL, *url.URL, error) {
+	var cloud Cloud
+	if config.Cloud != "" {
+		var err error
+		if cloud, err = ParseCloud(config.Cloud); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	baseURL, err := url.Parse(config.BaseURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse base URL: %w", err)
+	}
+	if config.BaseURL == "" && cloud != "" {
+		baseURL = cloud.RESTURL()
+	}
+
+	var wsURL *url.URL
+	switch {
+	case config.WebsocketURL != "":
+		if wsURL, err = url.Parse(config.WebsocketURL); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse websocket URL: %w", err)
+		}
+		if wsURL.Path == "" {
+			wsURL.Path = websocketPath
+		}
+	case cloud != "":
+		wsURL = cloud.WebsocketURL()
+	}
+
+	return baseURL, wsURL, nil
+}
+
+// configureTransport builds the HTTP client used for REST requests from the supplied options, and
+// derives the TLS, proxy and dial settings shared with websocket connections.
+func (c *APIClient) configureTransport(o *options) error {
+	hc := &http.Client{Timeout: c.timeout}
+	if o.httpClient != nil {
+		copied := *o.httpClient
+		hc = &copied
+	}
+
+	rt := hc.Transport
+	if o.transport != nil {
+		rt = o.transport
+	}
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	t, ok := rt.(*http.Transport)
+	if (o.tlsConfig != nil || o.proxy != nil) && !ok {
+		return fmt.Errorf("TLS and proxy options require an *http.Transport, got: %T", rt)
+	}
+	if ok {
+		t = t.Clone()
+		if o.tlsConfig != nil {
+			t.TLSClientConfig = o.tlsConfig
+		}
+		if o.proxy != nil {
+			t.Proxy = o.proxy
+		}
+		rt = t
+
+		c.tlsConfig = t.TLSClientConfig
+		c.proxy = t.Proxy
+		c.proxyConnectHeader = t.ProxyConnectHeader
+		if t.DialContext != nil {
+			c.dialContext = withDialTimeout(t.DialContext, c.timeout)
+		}
+	}
+	if c.dialContext == nil {
+		c.dialContext = (&net.Dialer{Timeout: c.timeout}).DialContext
+	}
+
+	if hc.Jar == nil {
+		// The cookie jar holds the session cookies, and is only populated in session authentication mode.
+		hc.Jar = &sessionJar{s: c.session}
+	}
+
+	hc.Transport = rt
+	c.client = hc
+
+	return nil
 }
 
 // doRequest performs that actual HTTP client request against the provided API endpoint.
 // It constructs the URL based on the client configuration and supplied path, sets an
 // authentication header based on the API key, and returns the response or any errors.
-func (c *APIClient) doRequest(method string, u *url.URL, body interface{}) (*http.Response, error) {
-	var reqBody io.Reader
+// The supplied context is attached to the outgoing request and governs its cancellation.
+//
+// GET requests to endpoints with a cache TTL are served through the response cache, and successful
+// mutating requests invalidate the cached responses they affect. Each call is traced with a span.
+func (c *APIClient) doRequest(ctx context.Context, method string, u *url.URL, body interface{}) (resp *http.Response, err error) {
+	ctx, span := c.startRequestSpan(ctx, method, u)
+	defer func() {
+		endRequestSpan(span, resp, err)
+	}()
+
+	var data []byte
 	if body != nil {
-		data, err := json.Marshal(body)
+		var err error
+		data, err = json.Marshal(body)
 		if err != nil {
 			return nil, err
 		}
-		c.logger.Trace("api request body", "body", string(data))
-		reqBody = bytes.NewBuffer(data)
 	}
 
-	req, err := http.NewRequest(method, u.String(), reqBody)
-	if err != nil {
-		return nil, err
+	if method == http.MethodGet {
+		return c.coalescedGet(ctx, u, func(ctx context.Context) (*http.Response, error) {
+			if ttl := c.cache.ttl(requestPath(u)); ttl > 0 {
+				return c.cachedGet(ctx, u, ttl)
+			}
+			return c.execute(ctx, method, u, nil, nil)
+		})
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Token %s", c.apiKey))
-	req.Header.Set("Content-Type", "application/json")
+	resp, err = c.execute(ctx, method, u, data, nil)
+	if err == nil && method != http.MethodGet && resp.StatusCode < http.StatusMultipleChoices {
+		p := requestPath(u)
+		c.cache.invalidate(p, path.Dir(p))
+	}
 
-	c.logger.Trace("making API request", "method", method, "url", u.String())
-	resp, err := c.client.Do(req)
+	return resp, err
+}
+
+// execute sends a request with any additional headers, retrying idempotent requests according to the retry
+// policy in effect for the context. In session authentication mode, the client logs in first if required,
+// and again should the session have expired.
+func (c *APIClient) execute(ctx context.Context, method string, u *url.URL, data []byte, header http.Header) (*http.Response, error) {
+	generation, err := c.ensureSession(ctx)
 	if err != nil {
-		c.logger.Error("request failed", "error", err)
 		return nil, err
 	}
-	c.logger.Trace("api response received", "status", resp.StatusCode)
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("unable to read response body: %w", err)
+	resp, err := c.sendWithRetry(ctx, method, u, data, header)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && c.expireSession(generation) {
+		// The session has expired, so log in again, unless a concurrent request already has, and repeat the
+		// request once.
+		resp.Body.Close()
+		c.logger.Debug("session expired, logging in again")
+		if _, err := c.ensureSession(ctx); err != nil {
+			return nil, err
+		}
+		return c.sendWithRetry(ctx, method, u, data, header)
 	}
-	c.logger.Trace("api response body", "body", string(respBody))
-	resp.Body = io.NopCloser(bytes.NewBuffer(respBody))
 
-	return resp, nil
+	return resp, err
 }
 
-// extractError is a convenience method for decoding the response body and returning it as an error.
-// It is typically called when a returned HTTP status code does not match the expected value.
-func extractError(r *http.Response) error {
-	body, err := io.ReadAll(r.Body)
+// send performs a single attempt of an HTTP client request with any additional headers, passing it through
+// the middleware chain, which authenticates the request and buffers the response.
+func (c *APIClient) send(ctx context.Context, method string, u *url.URL, data []byte, header http.Header, attempt int) (*http.Response, error) {
+	r, err := c.newRequest(ctx, method, u, data, header)
 	if err != nil {
-		return fmt.Errorf("API request failed with status %d and error reading body: %v", r.StatusCode, err)
+		return nil, err
 	}
-	return fmt.Errorf("API request failed with status %d: %s", r.StatusCode, string(body))
+	r.Attempt = attempt
+
+	return c.handler(r)
 }
 
 // Get is a convenience function for performing HTTP GET requests using the API client.
 func (c *APIClient) Get(u *url.URL) (*http.Response, error) {
-	return c.doRequest("GET", u, nil)
+	return c.GetContext(context.Background(), u)
+}
+
+// GetContext performs an HTTP GET request using the API client, bound to the supplied context.
+func (c *APIClient) GetContext(ctx context.Context, u *url.URL) (*http.Response, error) {
+	return c.doRequest(ctx, "GET", u, nil)
 }
 
 // Post is a convenience function for performing HTTP POST requests using the API client.
 func (c *APIClient) Post(u *url.URL, body interface{}) (*http.Response, error) {
-	return c.doRequest("POST", u, body)
+	return c.PostContext(context.Background(), u, body)
+}
+
+// PostContext performs an HTTP POST request using the API client, bound to the supplied context.
+func (c *APIClient) PostContext(ctx context.Context, u *url.URL, body interface{}) (*http.Response, error) {
+	return c.doRequest(ctx, "POST", u, body)
 }
 
 // Put is a convenience function for performing HTTP PUT requests using the API client.
 func (c *APIClient) Put(u *url.URL, body interface{}) (*http.Response, error) {
-	return c.doRequest("PUT", u, body)
+	return c.PutContext(context.Background(), u, body)
+}
+
+// PutContext performs an HTTP PUT request using the API client, bound to the supplied context.
+func (c *APIClient) PutContext(ctx context.Context, u *url.URL, body interface{}) (*http.Response, error) {
+	return c.doRequest(ctx, "PUT", u, body)
 }
 
 // Delete is a convenience function for performing HTTP DELETE requests using the API client.
 func (c *APIClient) Delete(u *url.URL) (*http.Response, error) {
-	return c.doRequest("DELETE", u, nil)
+	return c.DeleteContext(context.Background(), u)
+}
+
+// DeleteContext performs an HTTP DELETE request using the API client, bound to the supplied context.
+func (c *APIClient) DeleteContext(ctx context.Context, u *url.URL) (*http.Response, error) {
+	return c.doRequest(ctx, "DELETE", u, nil)
 }
 
-// GetWebsocketURL maps the base API URL into the appropriate websocket endpoint.
+// GetWebsocketURL returns the websocket endpoint for the client.
+//
+// An explicitly configured websocket URL, or that of the configured cloud, is returned as-is. Otherwise the
+// base API URL is mapped onto the websocket host of the matching registered cloud, falling back to replacing
+// an 'api.' host prefix with 'api-ws.'.
 // See https://www.juniper.net/documentation/us/en/software/mist/api/http/guides/websockets/hosts
 func (c *APIClient) GetWebsocketURL() (*url.URL, error) {
+	if c.wsURL != nil {
+		u := *c.wsURL
+		return &u, nil
+	}
+
 	u := *c.baseURL
 
 	switch u.Scheme {
@@ -224,104 +455,128 @@ func (c *APIClient) GetWebsocketURL() (*url.URL, error) {
 		return nil, fmt.Errorf("unsupported websocket URL scheme: %s", u.Scheme)
 	}
 
+	u.Path = websocketPath
+
+	if cloud, ok := cloudForHost(u.Hostname()); ok {
+		hosts, _ := cloud.Hosts()
+		u.Host = hosts.Websocket
+		if port := c.baseURL.Port(); port != "" {
+			u.Host = net.JoinHostPort(hosts.Websocket, port)
+		}
+		return &u, nil
+	}
+
 	if !strings.HasPrefix(u.Host, "api.") {
 		return nil, fmt.Errorf("unable to determine websocket endpoint address, base URL is not prefixed with 'api.': %s", u.Host)
 	}
 
 	u.Host = strings.Replace(u.Host, "api.", "api-ws.", 1)
-	u.Path = "/api-ws/v1/stream"
 
 	return &u, nil
 }
 
 // ConnectWebSocket opens a websocket connection to the appropriate websocket endpoint.
 func (c *APIClient) ConnectWebSocket() (*websocket.Conn, error) {
+	return c.ConnectWebSocketContext(context.Background())
+}
+
+// ConnectWebSocketContext opens a websocket connection to the appropriate websocket endpoint.
+// The supplied context bounds the dial and handshake, but not the lifetime of the returned connection.
+func (c *APIClient) ConnectWebSocketContext(ctx context.Context) (*websocket.Conn, error) {
+	conn, _, err := c.connectWebSocket(ctx)
+	return conn, err
+}
+
+// connectWebSocket opens a websocket connection, returning it along with the underlying network connection,
+// which records when data was last read from it.
+func (c *APIClient) connectWebSocket(ctx context.Context) (*websocket.Conn, *activityConn, error) {
 	u, err := c.GetWebsocketURL()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse base URL: %w", err)
+		return nil, nil, fmt.Errorf("failed to parse base URL: %w", err)
 	}
 
 	wsConfig, err := websocket.NewConfig(u.String(), c.baseURL.String())
 	if err != nil {
-		return nil, fmt.Errorf("failed to create websocket config: %w", err)
+		return nil, nil, fmt.Errorf("failed to create websocket config: %w", err)
 	}
 
-	wsConfig.TlsConfig = &tls.Config{
-		ServerName: u.Host,
+	if _, err := c.ensureSession(ctx); err != nil {
+		return nil, nil, err
 	}
-
-	wsConfig.Dialer = &net.Dialer{
-		Timeout: c.client.Timeout,
+	var token string
+	if !c.session.enabled.Load() {
+		waitCtx, cancel := c.waitContext(ctx)
+		token, err = c.tokens.acquire(waitCtx)
+		cancel()
+		if err != nil {
+			return nil, nil, err
+		}
 	}
-
-	wsConfig.Header.Set("Authorization", fmt.Sprintf("Token %s", c.apiKey))
+	c.setWebsocketAuthHeaders(wsConfig.Header, token)
+	c.propagator.Inject(ctx, propagation.HeaderCarrier(wsConfig.Header))
 	wsConfig.Header.Set("Content-Type", "application/json")
+	if c.userAgent != "" {
+		wsConfig.Header.Set("User-Agent", c.userAgent)
+	}
 
-	return websocket.DialConfig(wsConfig)
-}
-
-// Subscribe sends a subscription request over a new websocket connection and returns a channel over which received messages will be sent.
-func (c *APIClient) Subscribe(ctx context.Context, channel string) (<-chan WebsocketMessage, error) {
-	conn, err := c.ConnectWebSocket()
+	dialed, err := c.dialWebsocket(ctx, u)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to websocket: %w", err)
+		return nil, nil, &websocket.DialError{Config: wsConfig, Err: err}
 	}
-	c.logger.Debug("successfully connected to websocket", "url", conn.Config().Location.String())
+	netConn := newActivityConn(dialed)
 
-	if err := websocket.JSON.Send(conn, SubscriptionRequest{Subscribe: channel}); err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to send websocket subscription request: %w", err)
+	// The websocket handshake does not accept a context, so bound it with a deadline on the
+	// underlying connection instead.
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
 	}
-	c.logger.Debug("successfully sent websocket subscription request", "channel", channel)
-
-	var subResp SubscriptionResponse
-	conn.SetReadDeadline(time.Now().Add(c.client.Timeout))
-	if err := websocket.JSON.Receive(conn, &subResp); err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to receive websocket subscription response: %w", err)
+	netConn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		netConn.SetDeadline(time.Now())
+	})
+
+	conn, err := websocket.NewClient(wsConfig, netConn)
+	if !stop() {
+		// The context was done during the handshake, which has been aborted by the deadline.
+		err = ctx.Err()
 	}
-	conn.SetReadDeadline(time.Time{})
-	c.logger.Debug("successfully received websocket subscription response", "channel", channel)
-
-	if subResp.Event != "channel_subscribed" {
-		conn.Close()
-		return nil, fmt.Errorf("websocket subscription failed: %s", subResp.Event)
+	if err != nil {
+		netConn.Close()
+		return nil, nil, &websocket.DialError{Config: wsConfig, Err: err}
 	}
-	c.logger.Debug("successfully subscribed to websocket channel", "channel", channel)
+	netConn.SetDeadline(time.Time{})
 
-	// Spawn a watcher to unsubscribe and close the conn when the context is done
-	go func() {
-		<-ctx.Done()
-		err := c.Unsubscribe(conn, channel)
-		if err != nil {
-			c.logger.Error("failed to unsubscribe from websocket channel", "channel", channel, "error", err)
-		}
-		conn.Close()
-	}()
+	return conn, netConn, nil
+}
 
-	msgChan := make(chan WebsocketMessage)
+// Subscribe sends a subscription request over a new websocket connection and returns a channel over which received messages will be sent.
+//
+// The channel is closed once the context is done or the connection is lost, unless the subscription is made
+// resilient with WithReconnect. To subscribe to many channels over shared connections, use a WebsocketSession.
+// The subscription is traced with a span lasting until it ends, with an event for each message received.
+func (c *APIClient) Subscribe(ctx context.Context, channel string, opts ...SubscribeOption) (<-chan WebsocketMessage, error) {
+	sub, err := c.Subscription(ctx, channel, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return sub.C, nil
+}
 
-	go func() {
-		defer close(msgChan)
+// Subscription is like Subscribe, but returns a handle on the subscription whose Err method reports why it
+// ended, and whose Close method closes its connection.
+func (c *APIClient) Subscription(ctx context.Context, channel string, opts ...SubscribeOption) (*Subscription[WebsocketMessage], error) {
+	s := c.NewWebsocketSession(ctx, opts...)
+	s.closeWhenIdle = true
 
-		for {
-			var msg WebsocketMessage
-			err := websocket.JSON.Receive(conn, &msg)
-			if err != nil {
-				// If context is done, this is an expected error on connection close.
-				if ctx.Err() != nil {
-					c.logger.Debug("websocket connection closed", "channel", channel)
-					return
-				}
-				c.logger.Error("websocket receive error", "channel", channel, "error", err)
-				return
-			}
-			c.logger.Trace("websocket message received", "channel", msg.Channel, "data", msg.Data)
-			msgChan <- msg
-		}
-	}()
+	sub, err := s.Subscription(ctx, channel)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	sub.stop = s.Close
 
-	return msgChan, nil
+	return sub, nil
 }
 
 // Unsubscribe sends an unsubscribe request over an existing websocket connection.
@@ -333,28 +588,3 @@ func (c *APIClient) Unsubscribe(conn *websocket.Conn, channel string) error {
 
 	return nil
 }
-
-// streamStats is a generic helper to subscribe to a websocket channel and stream typed data
-func streamStats[T any](ctx context.Context, c *APIClient, channel string) (<-chan T, error) {
-	msgChan, err := c.Subscribe(ctx, channel)
-	if err != nil {
-		return nil, fmt.Errorf("failed to subscribe to websocket channel %s: %w", channel, err)
-	}
-
-	statChan := make(chan T)
-
-	go func() {
-		defer close(statChan)
-
-		for msg := range msgChan {
-			var stat T
-			if err := json.Unmarshal([]byte(msg.Data), &stat); err != nil {
-				c.logger.Error("failed to unmarshal websocket message", "channel", channel, "error", err)
-				continue
-			}
-			statChan <- stat
-		}
-	}()
-
-	return statChan, nil
-}
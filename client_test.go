@@ -1,6 +1,9 @@
 package mistclient
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -25,8 +28,8 @@ func TestNew(t *testing.T) {
 	if c.baseURL.Scheme != "https" && c.baseURL.Host != "test.url.com" {
 		t.Errorf("NewClient: expected baseURL: %s, got: %s", testURL, c.baseURL.String())
 	}
-	if c.apiKey != testKey {
-		t.Errorf("NewClient: expected APIKey: %s, got: %s", testKey, c.apiKey)
+	if c.tokens.size() != 1 || c.tokens.tokens[0].key != testKey {
+		t.Errorf("NewClient: expected APIKey: %s, got: %s", testKey, c.tokens.tokens[0].key)
 	}
 	if c.client.Timeout != time.Duration(10)*time.Second {
 		t.Errorf("NewClient: expected Timeout: 10, got: %d", c.client.Timeout)
@@ -76,6 +79,45 @@ func TestGetWebsocketURL(t *testing.T) {
 	}
 }
 
+func TestGetContextCancelled(t *testing.T) {
+	c := newTestClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := c.GetSelfContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("APIClient.GetSelfContext(): expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestGetContextDeadline(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = c.GetOrgSitesContext(ctx, "test-org-id")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("APIClient.GetOrgSitesContext(): expected context.DeadlineExceeded, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("APIClient.GetOrgSitesContext(): request was not cancelled promptly, took: %s", elapsed)
+	}
+}
+
 func testAPIServer(t *testing.T) *httptest.Server {
 	t.Helper()
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -188,3 +230,8 @@ func testWebsocketServer(t *testing.T, subShouldFail bool, dataToSend ...string)
 	mux.Handle("/api-ws/v1/stream", handler)
 	return httptest.NewServer(mux)
 }
+
+// jsonDecode decodes the JSON body of a test server request.
+func jsonDecode(r *http.Request, v any) error {
+	return json.NewDecoder(r.Body).Decode(v)
+}
@@ -0,0 +1,119 @@
+package mistclient
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// websocketPath is the path of the Mist websocket streaming endpoint.
+const websocketPath = "/api-ws/v1/stream"
+
+// Cloud identifies a Mist regional cloud.
+// See https://www.juniper.net/documentation/us/en/software/mist/api/http/guides/websockets/hosts
+type Cloud string
+
+// The Mist regional clouds.
+const (
+	CloudGlobal01 Cloud = "global01"
+	CloudGlobal02 Cloud = "global02"
+	CloudGlobal03 Cloud = "global03"
+	CloudGlobal04 Cloud = "global04"
+	CloudGlobal05 Cloud = "global05"
+	CloudEMEA01   Cloud = "emea01"
+	CloudEMEA02   Cloud = "emea02"
+	CloudEMEA03   Cloud = "emea03"
+	CloudEMEA04   Cloud = "emea04"
+	CloudAPAC01   Cloud = "apac01"
+	CloudAPAC02   Cloud = "apac02"
+	CloudAPAC03   Cloud = "apac03"
+	CloudUSGov    Cloud = "usgov"
+)
+
+// CloudHosts holds the hostnames serving a Mist regional cloud.
+type CloudHosts struct {
+	Name      string
+	REST      string
+	Websocket string
+	Portal    string
+}
+
+// clouds is the registry of Mist regional clouds.
+var clouds = map[Cloud]CloudHosts{
+	CloudGlobal01: {Name: "Global 01", REST: "api.mist.com", Websocket: "api-ws.mist.com", Portal: "manage.mist.com"},
+	CloudGlobal02: {Name: "Global 02", REST: "api.gc1.mist.com", Websocket: "api-ws.gc1.mist.com", Portal: "manage.gc1.mist.com"},
+	CloudGlobal03: {Name: "Global 03", REST: "api.ac2.mist.com", Websocket: "api-ws.ac2.mist.com", Portal: "manage.ac2.mist.com"},
+	CloudGlobal04: {Name: "Global 04", REST: "api.gc2.mist.com", Websocket: "api-ws.gc2.mist.com", Portal: "manage.gc2.mist.com"},
+	CloudGlobal05: {Name: "Global 05", REST: "api.gc4.mist.com", Websocket: "api-ws.gc4.mist.com", Portal: "manage.gc4.mist.com"},
+	CloudEMEA01:   {Name: "EMEA 01", REST: "api.eu.mist.com", Websocket: "api-ws.eu.mist.com", Portal: "manage.eu.mist.com"},
+	CloudEMEA02:   {Name: "EMEA 02", REST: "api.gc3.mist.com", Websocket: "api-ws.gc3.mist.com", Portal: "manage.gc3.mist.com"},
+	CloudEMEA03:   {Name: "EMEA 03", REST: "api.ac6.mist.com", Websocket: "api-ws.ac6.mist.com", Portal: "manage.ac6.mist.com"},
+	CloudEMEA04:   {Name: "EMEA 04", REST: "api.gc6.mist.com", Websocket: "api-ws.gc6.mist.com", Portal: "manage.gc6.mist.com"},
+	CloudAPAC01:   {Name: "APAC 01", REST: "api.ac5.mist.com", Websocket: "api-ws.ac5.mist.com", Portal: "manage.ac5.mist.com"},
+	CloudAPAC02:   {Name: "APAC 02", REST: "api.gc5.mist.com", Websocket: "api-ws.gc5.mist.com", Portal: "manage.gc5.mist.com"},
+	CloudAPAC03:   {Name: "APAC 03", REST: "api.gc7.mist.com", Websocket: "api-ws.gc7.mist.com", Portal: "manage.gc7.mist.com"},
+	CloudUSGov:    {Name: "US Gov", REST: "api.us.mist-federal.com", Websocket: "api-ws.us.mist-federal.com", Portal: "manage.us.mist-federal.com"},
+}
+
+// Clouds returns all registered Mist regional clouds, in a stable order.
+func Clouds() []Cloud {
+	keys := make([]Cloud, 0, len(clouds))
+	for k := range clouds {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// ParseCloud returns the Cloud identified by name. Names are matched ignoring case, spaces, hyphens
+// and underscores, so "Global 01", "global-01" and "global01" all identify CloudGlobal01.
+func ParseCloud(name string) (Cloud, error) {
+	normalised := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '_':
+			return -1
+		}
+		return r
+	}, strings.ToLower(name))
+
+	cloud := Cloud(normalised)
+	if _, ok := clouds[cloud]; !ok {
+		return "", fmt.Errorf("unknown Mist cloud: %q", name)
+	}
+	return cloud, nil
+}
+
+// Hosts returns the hostnames serving the cloud.
+func (c Cloud) Hosts() (CloudHosts, bool) {
+	hosts, ok := clouds[c]
+	return hosts, ok
+}
+
+// String returns the display name of the cloud, e.g. "EMEA 01".
+func (c Cloud) String() string {
+	if hosts, ok := clouds[c]; ok {
+		return hosts.Name
+	}
+	return string(c)
+}
+
+// RESTURL returns the base URL of the cloud's REST API.
+func (c Cloud) RESTURL() *url.URL {
+	return &url.URL{Scheme: "https", Host: clouds[c].REST}
+}
+
+// WebsocketURL returns the URL of the cloud's websocket streaming endpoint.
+func (c Cloud) WebsocketURL() *url.URL {
+	return &url.URL{Scheme: "wss", Host: clouds[c].Websocket, Path: websocketPath}
+}
+
+// cloudForHost returns the registered cloud whose REST API is served by the given host.
+func cloudForHost(host string) (Cloud, bool) {
+	for cloud, hosts := range clouds {
+		if strings.EqualFold(hosts.REST, host) {
+			return cloud, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,153 @@
+package mistclient
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseCloud(t *testing.T) {
+	tests := []struct {
+		name      string
+		want      Cloud
+		expectErr bool
+	}{
+		{name: "global01", want: CloudGlobal01},
+		{name: "Global 02", want: CloudGlobal02},
+		{name: "EMEA-03", want: CloudEMEA03},
+		{name: "apac_01", want: CloudAPAC01},
+		{name: "US Gov", want: CloudUSGov},
+		{name: "global06", expectErr: true},
+		{name: "", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCloud(tt.name)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseCloud(%q) error = %v, expectErr %v", tt.name, err, tt.expectErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseCloud(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloudRegistry(t *testing.T) {
+	if n := len(Clouds()); n != 13 {
+		t.Errorf("Clouds(): expected 13 registered clouds, got: %d", n)
+	}
+	for _, cloud := range Clouds() {
+		hosts, ok := cloud.Hosts()
+		if !ok {
+			t.Errorf("Cloud(%q).Hosts(): not registered", cloud)
+			continue
+		}
+		if hosts.Name == "" || hosts.REST == "" || hosts.Websocket == "" || hosts.Portal == "" {
+			t.Errorf("Cloud(%q).Hosts(): incomplete hosts: %+v", cloud, hosts)
+		}
+		if parsed, err := ParseCloud(hosts.Name); err != nil || parsed != cloud {
+			t.Errorf("ParseCloud(%q): expected %q, got: %q (%v)", hosts.Name, cloud, parsed, err)
+		}
+	}
+}
+
+func TestNewWithCloud(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      Config
+		wantBaseURL string
+		wantWSURL   string
+		expectErr   bool
+	}{
+		{
+			name:        "Cloud only",
+			config:      Config{Cloud: "EMEA 01"},
+			wantBaseURL: "https://api.eu.mist.com",
+			wantWSURL:   "wss://api-ws.eu.mist.com/api-ws/v1/stream",
+		},
+		{
+			name:        "Cloud with explicit base URL",
+			config:      Config{Cloud: "global01", BaseURL: "https://mist-proxy.example.com"},
+			wantBaseURL: "https://mist-proxy.example.com",
+			wantWSURL:   "wss://api-ws.mist.com/api-ws/v1/stream",
+		},
+		{
+			name:        "Explicit URLs",
+			config:      Config{BaseURL: "https://mist-proxy.example.com", WebsocketURL: "wss://mist-ws-proxy.example.com"},
+			wantBaseURL: "https://mist-proxy.example.com",
+			wantWSURL:   "wss://mist-ws-proxy.example.com/api-ws/v1/stream",
+		},
+		{
+			name:        "Registered REST host",
+			config:      Config{BaseURL: "https://api.gc1.mist.com"},
+			wantBaseURL: "https://api.gc1.mist.com",
+			wantWSURL:   "wss://api-ws.gc1.mist.com/api-ws/v1/stream",
+		},
+		{
+			name:      "Unknown cloud",
+			config:    Config{Cloud: "mars01"},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(&tt.config, nil)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("New() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if tt.expectErr {
+				return
+			}
+			if c.baseURL.String() != tt.wantBaseURL {
+				t.Errorf("New(): expected base URL %s, got: %s", tt.wantBaseURL, c.baseURL)
+			}
+			wsURL, err := c.GetWebsocketURL()
+			if err != nil {
+				t.Fatalf("GetWebsocketURL(): unexpected error: %v", err)
+			}
+			if wsURL.String() != tt.wantWSURL {
+				t.Errorf("GetWebsocketURL(): expected %s, got: %s", tt.wantWSURL, wsURL)
+			}
+		})
+	}
+}
+
+func TestStreamSiteDevicesExplicitWebsocketURL(t *testing.T) {
+	testDevice := Device{Mac: "5c5b350e0001", Name: "test-ap"}
+	testData, err := json.Marshal(testDevice)
+	if err != nil {
+		t.Fatalf("failed to marshal test data: %v", err)
+	}
+
+	wsServer := testWebsocketServer(t, false, string(testData))
+	defer wsServer.Close()
+
+	c, err := New(&Config{BaseURL: "https://mist-proxy.example.com", WebsocketURL: "ws" + wsServer.URL[len("http"):], APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	devChan, err := c.StreamSiteDevices(ctx, "test-site-id")
+	if err != nil {
+		t.Fatalf("APIClient.StreamSiteDevices() threw error: %v", err)
+	}
+
+	select {
+	case dev, ok := <-devChan:
+		if !ok {
+			t.Fatal("APIClient.StreamSiteDevices(): channel closed unexpectedly")
+		}
+		if dev.Mac != testDevice.Mac {
+			t.Errorf("APIClient.StreamSiteDevices().Mac: expected %q, got %q", testDevice.Mac, dev.Mac)
+		}
+	case <-ctx.Done():
+		t.Fatal("APIClient.StreamSiteDevices(): timed out waiting for device")
+	}
+}
@@ -0,0 +1,185 @@
+package mistclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// noCoalescingKey is the context key marking requests that must not share an in-flight request.
+type noCoalescingKey struct{}
+
+// ContextWithoutCoalescing returns a copy of ctx that opts any GET request made with it out of request
+// coalescing, so that it is always sent to the API rather than sharing an identical request already in flight.
+func ContextWithoutCoalescing(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCoalescingKey{}, true)
+}
+
+// coalescingDisabled reports whether requests made with the given context opt out of request coalescing.
+func coalescingDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(noCoalescingKey{}).(bool)
+	return disabled
+}
+
+// flight is a GET request in progress on behalf of one or more callers.
+type flight struct {
+	done    chan struct{}
+	waiters int
+	cancel  context.CancelFunc
+
+	// resp is the response, whose body is streamed to a sole waiter, or read into body when shared.
+	resp   *http.Response
+	body   []byte
+	shared bool
+	err    error
+}
+
+// response returns a copy of a shared flight's response, with its own reader over the body.
+func (f *flight) response() *http.Response {
+	resp := *f.resp
+	resp.Header = f.resp.Header.Clone()
+	resp.Body = io.NopCloser(bytes.NewReader(f.body))
+	resp.ContentLength = int64(len(f.body))
+	return &resp
+}
+
+// flightGroup coalesces concurrent identical GET requests, so that callers asking for the same URL while
+// a request for it is awaiting its response share that request rather than each sending their own.
+//
+// The shared request runs independently of any one caller's context. A caller whose context is done stops
+// waiting and returns its context's error, and the request is cancelled only once every caller has gone.
+// A body streamed to a sole caller is read subject to that caller's context.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// newFlightGroup returns an empty flightGroup.
+func newFlightGroup() *flightGroup {
+	return &flightGroup{flights: make(map[string]*flight)}
+}
+
+// do calls fn to fetch key, unless a fetch of it is already in flight, in which case the caller waits for
+// and shares its result. It reports whether the result was shared with other callers.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) (*http.Response, error)) (*http.Response, bool, error) {
+	g.mu.Lock()
+	f, ok := g.flights[key]
+	if !ok {
+		fctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.flights[key] = f
+		go g.run(fctx, key, f, fn)
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		g.leave(f)
+		return nil, false, ctx.Err()
+	}
+
+	if f.err != nil {
+		return nil, f.shared, f.err
+	}
+	if f.shared {
+		return f.response(), true, nil
+	}
+	if body, ok := f.resp.Body.(*flightBody); ok {
+		// The body is streamed to this caller alone, so it is read subject to the caller's context.
+		body.stop = context.AfterFunc(ctx, f.cancel)
+	}
+	return f.resp, false, nil
+}
+
+// run fetches the response for a flight. The flight is open to new callers until the response headers have
+// been received; if more than one caller is then waiting, the body is read in full so that each gets a copy.
+func (g *flightGroup) run(ctx context.Context, key string, f *flight, fn func(context.Context) (*http.Response, error)) {
+	defer close(f.done)
+
+	resp, err := fn(ctx)
+
+	g.mu.Lock()
+	delete(g.flights, key)
+	waiters := f.waiters
+	g.mu.Unlock()
+
+	switch {
+	case err != nil:
+		f.cancel()
+		f.err = err
+	case waiters == 0:
+		// Every caller gave up while the request was in flight.
+		resp.Body.Close()
+		f.cancel()
+		f.err = ctx.Err()
+	case waiters == 1:
+		// A sole caller has the body streamed to it, releasing the request once it is closed.
+		resp.Body = &flightBody{ReadCloser: resp.Body, cancel: f.cancel}
+		f.resp = resp
+	default:
+		f.body, f.err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		f.cancel()
+		f.resp = resp
+		f.shared = true
+	}
+}
+
+// leave removes a caller that has stopped waiting for a flight, cancelling the request if it was the last.
+// Should the flight have completed meanwhile with a streamed body, the body is closed on its behalf.
+func (g *flightGroup) leave(f *flight) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	f.waiters--
+	if f.waiters > 0 {
+		return
+	}
+	f.cancel()
+	go func() {
+		<-f.done
+		if f.err == nil && !f.shared {
+			f.resp.Body.Close()
+		}
+	}()
+}
+
+// flightBody is a streamed response body that releases its flight's request context on Close. While it is
+// being read, the request is cancelled should the caller's context be done.
+type flightBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+	stop   func() bool
+}
+
+// Close implements io.Closer.
+func (b *flightBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.stop != nil {
+		b.stop()
+	}
+	b.cancel()
+	return err
+}
+
+// coalescedGet performs a GET request, sharing an identical request already in flight unless the context
+// opts out of coalescing.
+func (c *APIClient) coalescedGet(ctx context.Context, u *url.URL, fetch func(context.Context) (*http.Response, error)) (*http.Response, error) {
+	if coalescingDisabled(ctx) {
+		return fetch(ctx)
+	}
+
+	resp, shared, err := c.flights.do(ctx, u.String(), fetch)
+	trace.SpanFromContext(ctx).SetAttributes(attrCoalesced.Bool(shared))
+	if shared {
+		c.logger.Trace("shared in-flight API request", "url", u.String())
+	}
+	return resp, err
+}
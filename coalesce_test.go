@@ -0,0 +1,232 @@
+package mistclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testBlockingServer returns a server which serves an API token once release is closed, counting requests.
+// Requests whose context is cancelled before release are counted in cancelled.
+func testBlockingServer(t *testing.T, release <-chan struct{}, requests, cancelled *atomic.Int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			cancelled.Add(1)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "test-token-id", "name": "exporter"}`))
+	}))
+}
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waiters returns the number of callers waiting on the in-flight requests of a client.
+func waiters(c *APIClient) int {
+	c.flights.mu.Lock()
+	defer c.flights.mu.Unlock()
+
+	n := 0
+	for _, f := range c.flights.flights {
+		n += f.waiters
+	}
+	return n
+}
+
+func TestRequestCoalescing(t *testing.T) {
+	var requests, cancelled atomic.Int32
+	release := make(chan struct{})
+	s := testBlockingServer(t, release, &requests, &cancelled)
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	const callers = 5
+	var wg sync.WaitGroup
+	tokens := make([]OrgAPIToken, callers)
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tokens[i], errs[i] = c.GetOrgAPIToken("test-org-id", "test-token-id")
+		}()
+	}
+
+	waitFor(t, "callers to share the request", func() bool { return waiters(c) == callers })
+	close(release)
+	wg.Wait()
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("APIClient.GetOrgAPIToken(): expected 1 request to be sent, got: %d", n)
+	}
+	for i := range callers {
+		if errs[i] != nil || tokens[i].Name != "exporter" {
+			t.Errorf("APIClient.GetOrgAPIToken(): caller %d expected token 'exporter', got: %+v (err: %v)", i, tokens[i], errs[i])
+		}
+	}
+
+	// Once the response has been received, a new request is sent.
+	if _, err := c.GetOrgAPIToken("test-org-id", "test-token-id"); err != nil {
+		t.Fatalf("APIClient.GetOrgAPIToken(): unexpected error: %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("APIClient.GetOrgAPIToken(): expected 2 requests to be sent, got: %d", n)
+	}
+}
+
+func TestRequestCoalescingOptOut(t *testing.T) {
+	var requests, cancelled atomic.Int32
+	release := make(chan struct{})
+	s := testBlockingServer(t, release, &requests, &cancelled)
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	ctx := ContextWithoutCoalescing(context.Background())
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetOrgAPITokenContext(ctx, "test-org-id", "test-token-id"); err != nil {
+				t.Errorf("APIClient.GetOrgAPITokenContext(): unexpected error: %v", err)
+			}
+		}()
+	}
+
+	waitFor(t, "both requests to be sent", func() bool { return requests.Load() == 2 })
+	close(release)
+	wg.Wait()
+}
+
+func TestRequestCoalescingCancellation(t *testing.T) {
+	var requests, cancelled atomic.Int32
+	release := make(chan struct{})
+	s := testBlockingServer(t, release, &requests, &cancelled)
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	// A caller giving up does not affect the others sharing the request.
+	ctx, cancel := context.WithCancel(context.Background())
+	leaving := make(chan error)
+	go func() {
+		_, err := c.GetOrgAPITokenContext(ctx, "test-org-id", "test-token-id")
+		leaving <- err
+	}()
+	staying := make(chan error)
+	go func() {
+		_, err := c.GetOrgAPIToken("test-org-id", "test-token-id")
+		staying <- err
+	}()
+
+	waitFor(t, "callers to share the request", func() bool { return waiters(c) == 2 })
+	cancel()
+	if err := <-leaving; !errors.Is(err, context.Canceled) {
+		t.Errorf("APIClient.GetOrgAPITokenContext(): expected context.Canceled, got: %v", err)
+	}
+	close(release)
+	if err := <-staying; err != nil {
+		t.Errorf("APIClient.GetOrgAPIToken(): unexpected error: %v", err)
+	}
+	if n := cancelled.Load(); n != 0 {
+		t.Errorf("expected the shared request to complete, got %d cancelled", n)
+	}
+}
+
+func TestRequestCoalescingAbandoned(t *testing.T) {
+	var requests, cancelled atomic.Int32
+	release := make(chan struct{})
+	defer close(release)
+	s := testBlockingServer(t, release, &requests, &cancelled)
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	// The shared request is cancelled once every caller has given up.
+	ctx, cancel := context.WithCancel(context.Background())
+	leaving := make(chan error)
+	for range 2 {
+		go func() {
+			_, err := c.GetOrgAPITokenContext(ctx, "test-org-id", "test-token-id")
+			leaving <- err
+		}()
+	}
+
+	waitFor(t, "callers to share the request", func() bool { return waiters(c) == 2 && requests.Load() == 1 })
+	cancel()
+	for range 2 {
+		if err := <-leaving; !errors.Is(err, context.Canceled) {
+			t.Errorf("APIClient.GetOrgAPITokenContext(): expected context.Canceled, got: %v", err)
+		}
+	}
+	waitFor(t, "the request to be cancelled", func() bool { return cancelled.Load() == 1 })
+}
+
+func TestRequestCoalescingStreamedBodyCancellation(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"mac":"a"},`))
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(3 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	// Cancelling the sole caller's context stops the body being read, rather than waiting on the server.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	var errs []error
+	for _, err := range c.AllSiteDeviceStats(ctx, "test-site-id") {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], context.Canceled) {
+		t.Errorf("APIClient.AllSiteDeviceStats(): expected context.Canceled, got: %v", errs)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("APIClient.AllSiteDeviceStats(): expected cancellation to end iteration promptly, took %v", elapsed)
+	}
+}
@@ -0,0 +1,265 @@
+package mistclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables read by ConfigFromEnv and LoadConfig. Each *_FILE variable names a file holding
+// the corresponding secret, as an alternative to passing the secret itself in the environment.
+const (
+	EnvAPIKey         = "MIST_API_KEY"
+	EnvAPIKeyFile     = "MIST_API_KEY_FILE"
+	EnvBaseURL        = "MIST_BASE_URL"
+	EnvCloud          = "MIST_CLOUD"
+	EnvTimeout        = "MIST_TIMEOUT"
+	EnvEmail          = "MIST_EMAIL"
+	EnvPassword       = "MIST_PASSWORD"
+	EnvPasswordFile   = "MIST_PASSWORD_FILE"
+	EnvTOTPSecret     = "MIST_TOTP_SECRET"
+	EnvTOTPSecretFile = "MIST_TOTP_SECRET_FILE"
+)
+
+// ErrInvalidConfig is returned, wrapping a description of each problem found, when a Config fails validation.
+var ErrInvalidConfig = errors.New("invalid config")
+
+// secretField describes a secret that may be given either directly or as the path of a file holding it.
+type secretField struct {
+	name     string
+	value    *string
+	file     *string
+	env      string
+	fileEnv  string
+	fileName string
+}
+
+// secrets returns the secret fields of a config.
+func (c *Config) secrets() []secretField {
+	return []secretField{
+		{name: "api_key", value: &c.APIKey, file: &c.APIKeyFile, env: EnvAPIKey, fileEnv: EnvAPIKeyFile, fileName: "api_key_file"},
+		{name: "password", value: &c.Password, file: &c.PasswordFile, env: EnvPassword, fileEnv: EnvPasswordFile, fileName: "password_file"},
+		{name: "totp_secret", value: &c.TOTPSecret, file: &c.TOTPSecretFile, env: EnvTOTPSecret, fileEnv: EnvTOTPSecretFile, fileName: "totp_secret_file"},
+	}
+}
+
+// LoadConfig reads a client configuration from a YAML file, using the keys given by the yaml tags of Config.
+//
+// Settings are resolved in order of precedence: environment variables (see ConfigFromEnv) override the
+// file, which overrides the defaults applied by New. Secrets may be given directly or read from a file
+// named by api_key_file, password_file or totp_secret_file, resolved relative to the config file. As with
+// MIST_TIMEOUT, timeout may be given as a duration such as "30s" or a number of seconds. The resulting
+// configuration is validated with Validate.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if timeoutInSeconds(&doc) {
+		if data, err = yaml.Marshal(&doc); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	var config Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	for _, s := range config.secrets() {
+		if *s.value != "" && *s.file != "" {
+			return nil, fmt.Errorf("%w: %s and %s are mutually exclusive", ErrInvalidConfig, s.name, s.fileName)
+		}
+		if *s.file != "" && !filepath.IsAbs(*s.file) {
+			*s.file = filepath.Join(filepath.Dir(path), *s.file)
+		}
+	}
+
+	if err := config.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := config.readSecretFiles(); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// ConfigFromEnv builds a client configuration from environment variables:
+//   - MIST_BASE_URL or MIST_CLOUD selects the API endpoint
+//   - MIST_API_KEY, or MIST_API_KEY_FILE naming a file holding it, authenticates requests
+//   - MIST_EMAIL with MIST_PASSWORD and optionally MIST_TOTP_SECRET, or their *_FILE variants, authenticate
+//     a session instead
+//   - MIST_TIMEOUT sets the request timeout, as a duration such as "30s" or a number of seconds
+//
+// Unset and empty variables are ignored. The resulting configuration is validated with Validate.
+func ConfigFromEnv() (*Config, error) {
+	var config Config
+	if err := config.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := config.readSecretFiles(); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// applyEnv overrides the config with any settings given by environment variables. A secret given in the
+// environment, directly or as a file, replaces the config's secret however that was given.
+func (c *Config) applyEnv() error {
+	baseURL, cloud := os.Getenv(EnvBaseURL), os.Getenv(EnvCloud)
+	if baseURL != "" {
+		c.BaseURL = baseURL
+	}
+	if cloud != "" {
+		c.Cloud = cloud
+		if baseURL == "" {
+			// The cloud takes precedence over the endpoints of a lower-precedence config file.
+			c.BaseURL, c.WebsocketURL = "", ""
+		}
+	}
+
+	if timeout := os.Getenv(EnvTimeout); timeout != "" {
+		d, err := parseTimeout(timeout)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrInvalidConfig, EnvTimeout, err)
+		}
+		c.Timeout = d
+	}
+
+	if email := os.Getenv(EnvEmail); email != "" {
+		c.Email = email
+	}
+
+	for _, s := range c.secrets() {
+		value, file := os.Getenv(s.env), os.Getenv(s.fileEnv)
+		switch {
+		case value != "" && file != "":
+			return fmt.Errorf("%w: %s and %s are mutually exclusive", ErrInvalidConfig, s.env, s.fileEnv)
+		case value != "":
+			*s.value, *s.file = value, ""
+		case file != "":
+			*s.value, *s.file = "", file
+		}
+	}
+
+	return nil
+}
+
+// timeoutInSeconds rewrites a timeout given in a config file as a whole number of seconds, which does not
+// decode into a time.Duration, as the equivalent duration. It reports whether the document was changed.
+func timeoutInSeconds(doc *yaml.Node) bool {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return false
+	}
+
+	fields := doc.Content[0].Content
+	for i := 0; i+1 < len(fields); i += 2 {
+		key, value := fields[i], fields[i+1]
+		if key.Value != "timeout" || value.Kind != yaml.ScalarNode || value.ShortTag() != "!!int" {
+			continue
+		}
+		seconds, err := strconv.Atoi(value.Value)
+		if err != nil {
+			return false
+		}
+		value.SetString((time.Duration(seconds) * time.Second).String())
+		return true
+	}
+	return false
+}
+
+// parseTimeout parses a timeout given as a duration or a whole number of seconds.
+func parseTimeout(s string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(s); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+// readSecretFiles reads any secrets given as files into the config.
+func (c *Config) readSecretFiles() error {
+	for _, s := range c.secrets() {
+		if *s.file == "" {
+			continue
+		}
+		data, err := os.ReadFile(*s.file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", s.name, err)
+		}
+		secret := strings.TrimSpace(string(data))
+		if secret == "" {
+			return fmt.Errorf("%w: %s file %s is empty", ErrInvalidConfig, s.name, *s.file)
+		}
+		*s.value = secret
+	}
+	return nil
+}
+
+// Validate checks that the config selects an API endpoint and supplies credentials, returning an error
+// wrapping ErrInvalidConfig that describes every problem found.
+func (c *Config) Validate() error {
+	var errs []error
+
+	switch {
+	case c.BaseURL == "" && c.Cloud == "":
+		errs = append(errs, fmt.Errorf("base_url (%s) or cloud (%s) is required", EnvBaseURL, EnvCloud))
+	case c.Cloud != "":
+		if _, err := ParseCloud(c.Cloud); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, field := range []struct{ name, raw string }{{"base_url", c.BaseURL}, {"websocket_url", c.WebsocketURL}} {
+		if field.raw == "" {
+			continue
+		}
+		if u, err := url.Parse(field.raw); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s %q is not an absolute URL", field.name, field.raw))
+		}
+	}
+
+	switch {
+	case c.Email != "":
+		if c.Password == "" {
+			errs = append(errs, fmt.Errorf("password (%s) is required to log in as %s", EnvPassword, c.Email))
+		}
+	case c.APIKey == "" && len(c.APIKeys) == 0:
+		errs = append(errs, fmt.Errorf("api_key (%s) is required, unless logging in with email and password", EnvAPIKey))
+	}
+
+	if c.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("timeout must not be negative, got %s", c.Timeout))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, errors.Join(errs...))
+	}
+	return nil
+}
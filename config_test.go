@@ -0,0 +1,174 @@
+package mistclient
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearMistEnv unsets every environment variable read by the config loaders for the duration of a test.
+func clearMistEnv(t *testing.T) {
+	t.Helper()
+	for _, env := range []string{EnvAPIKey, EnvAPIKeyFile, EnvBaseURL, EnvCloud, EnvTimeout, EnvEmail,
+		EnvPassword, EnvPasswordFile, EnvTOTPSecret, EnvTOTPSecretFile} {
+		t.Setenv(env, "")
+	}
+}
+
+// writeFile writes a file into dir, returning its path.
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	clearMistEnv(t)
+	dir := t.TempDir()
+	writeFile(t, dir, "api-key", "file-api-key\n")
+	path := writeFile(t, dir, "mist.yaml", `
+cloud: emea01
+api_key_file: api-key
+timeout: 30s
+retry:
+  max_attempts: 3
+  initial_backoff: 250ms
+cache:
+  ttls:
+    /api/v1/orgs/:org_id/sites: 10m
+`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig(): unexpected error: %v", err)
+	}
+
+	if config.Cloud != "emea01" || config.APIKey != "file-api-key" || config.Timeout != 30*time.Second {
+		t.Errorf("LoadConfig(): unexpected config: %+v", config)
+	}
+	if config.Retry.MaxAttempts != 3 || config.Retry.InitialBackoff != 250*time.Millisecond {
+		t.Errorf("LoadConfig(): unexpected retry policy: %+v", config.Retry)
+	}
+	if ttl := config.Cache.TTLs[EndpointOrgSites]; ttl != 10*time.Minute {
+		t.Errorf("LoadConfig(): expected sites TTL of 10m, got: %s", ttl)
+	}
+
+	if _, err := New(config, nil); err != nil {
+		t.Errorf("New(): unexpected error with loaded config: %v", err)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	clearMistEnv(t)
+	dir := t.TempDir()
+	path := writeFile(t, dir, "mist.yaml", `
+base_url: https://api.mist.com
+api_key: file-api-key
+timeout: 30s
+`)
+	secret := writeFile(t, dir, "env-api-key", "env-file-api-key")
+
+	t.Setenv(EnvCloud, "global03")
+	t.Setenv(EnvAPIKeyFile, secret)
+	t.Setenv(EnvTimeout, "5")
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig(): unexpected error: %v", err)
+	}
+
+	if config.BaseURL != "" || config.Cloud != "global03" {
+		t.Errorf("LoadConfig(): expected %s to override the file's base_url, got: %q, %q", EnvCloud, config.BaseURL, config.Cloud)
+	}
+	if config.APIKey != "env-file-api-key" {
+		t.Errorf("LoadConfig(): expected %s to override the file's api_key, got: %q", EnvAPIKeyFile, config.APIKey)
+	}
+	if config.Timeout != 5*time.Second {
+		t.Errorf("LoadConfig(): expected %s to override the file's timeout, got: %s", EnvTimeout, config.Timeout)
+	}
+}
+
+func TestLoadConfigTimeoutSeconds(t *testing.T) {
+	clearMistEnv(t)
+	path := writeFile(t, t.TempDir(), "mist.yaml", "cloud: global01\napi_key: x\n\n# Seconds, as for MIST_TIMEOUT.\ntimeout: 45\n")
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig(): unexpected error: %v", err)
+	}
+	if config.Timeout != 45*time.Second {
+		t.Errorf("LoadConfig(): expected a timeout of 45s, got: %s", config.Timeout)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		yaml    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "Unknown field", yaml: "base_url: https://api.mist.com\napi_token: x\n", wantErr: "field api_token not found"},
+		{name: "Missing endpoint", yaml: "api_key: x\n", wantErr: "base_url (MIST_BASE_URL) or cloud (MIST_CLOUD) is required"},
+		{name: "Missing credentials", yaml: "cloud: global01\n", wantErr: "api_key (MIST_API_KEY) is required"},
+		{name: "Missing password", yaml: "cloud: global01\nemail: admin@example.com\n", wantErr: "password (MIST_PASSWORD) is required"},
+		{name: "Unknown cloud", yaml: "cloud: mars01\napi_key: x\n", wantErr: `unknown Mist cloud: "mars01"`},
+		{name: "Relative base URL", yaml: "base_url: api.mist.com\napi_key: x\n", wantErr: `base_url "api.mist.com" is not an absolute URL`},
+		{name: "Secret and secret file", yaml: "cloud: global01\napi_key: x\napi_key_file: key\n", wantErr: "api_key and api_key_file are mutually exclusive"},
+		{name: "Missing secret file", yaml: "cloud: global01\napi_key_file: missing\n", wantErr: "failed to read api_key"},
+		{name: "Unknown field with timeout in seconds", yaml: "cloud: global01\napi_key: x\ntimeout: 30\napi_token: x\n", wantErr: "field api_token not found"},
+		{name: "Invalid timeout", yaml: "cloud: global01\napi_key: x\n", env: map[string]string{EnvTimeout: "soon"}, wantErr: `MIST_TIMEOUT: invalid duration "soon"`},
+		{name: "Secret and secret file in env", yaml: "cloud: global01\n", env: map[string]string{EnvAPIKey: "x", EnvAPIKeyFile: "key"}, wantErr: "MIST_API_KEY and MIST_API_KEY_FILE are mutually exclusive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearMistEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			path := writeFile(t, dir, "mist.yaml", tt.yaml)
+
+			_, err := LoadConfig(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadConfig(): expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	clearMistEnv(t)
+	secret := writeFile(t, t.TempDir(), "password", "hunter2\n")
+	t.Setenv(EnvBaseURL, "https://api.eu.mist.com")
+	t.Setenv(EnvEmail, "admin@example.com")
+	t.Setenv(EnvPasswordFile, secret)
+	t.Setenv(EnvTimeout, "1m")
+
+	config, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("ConfigFromEnv(): unexpected error: %v", err)
+	}
+	if config.BaseURL != "https://api.eu.mist.com" || config.Email != "admin@example.com" || config.Password != "hunter2" || config.Timeout != time.Minute {
+		t.Errorf("ConfigFromEnv(): unexpected config: %+v", config)
+	}
+
+	clearMistEnv(t)
+	_, err = ConfigFromEnv()
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("ConfigFromEnv(): expected ErrInvalidConfig, got: %v", err)
+	}
+	for _, want := range []string{EnvBaseURL, EnvAPIKey} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("ConfigFromEnv(): expected error to mention %s, got: %v", want, err)
+		}
+	}
+}
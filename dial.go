@@ -0,0 +1,175 @@
+package mistclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// dialWebsocket establishes the network connection underlying a websocket to u, honouring the client's
+// proxy, dialer and TLS settings so that websockets are subject to the same options as REST requests.
+func (c *APIClient) dialWebsocket(ctx context.Context, u *url.URL) (net.Conn, error) {
+	addr := websocketAuthority(u)
+
+	proxyURL, err := c.websocketProxy(u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine proxy: %w", err)
+	}
+
+	var conn net.Conn
+	if proxyURL != nil {
+		conn, err = c.dialProxy(ctx, proxyURL, addr)
+	} else {
+		conn, err = c.dialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "wss" {
+		return conn, nil
+	}
+
+	var tlsConfig *tls.Config
+	if c.tlsConfig != nil {
+		tlsConfig = c.tlsConfig.Clone()
+	} else {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake failed: %w", err)
+	}
+	return tlsConn, nil
+}
+
+// websocketAuthority returns the host:port address of a websocket URL, applying the default port for its scheme.
+func websocketAuthority(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "wss" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// websocketProxy returns the proxy, if any, to use for a websocket connection to u. The proxy function
+// is consulted with the equivalent HTTP(S) URL, so that environment-based selection behaves as for REST.
+func (c *APIClient) websocketProxy(u *url.URL) (*url.URL, error) {
+	if c.proxy == nil {
+		return nil, nil
+	}
+
+	target := *u
+	switch u.Scheme {
+	case "ws":
+		target.Scheme = "http"
+	case "wss":
+		target.Scheme = "https"
+	}
+	return c.proxy(&http.Request{Method: http.MethodGet, URL: &target, Header: http.Header{}})
+}
+
+// dialProxy connects to addr through an HTTP or HTTPS proxy using the CONNECT method.
+func (c *APIClient) dialProxy(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	var port string
+	switch proxyURL.Scheme {
+	case "http":
+		port = "80"
+	case "https":
+		port = "443"
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme: %q", proxyURL.Scheme)
+	}
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+
+	conn, err := c.dialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
+	}
+
+	if proxyURL.Scheme == "https" {
+		var tlsConfig *tls.Config
+		if c.tlsConfig != nil {
+			tlsConfig = c.tlsConfig.Clone()
+		} else {
+			tlsConfig = &tls.Config{}
+		}
+		tlsConfig.ServerName = proxyURL.Hostname()
+
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("proxy TLS handshake failed: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: c.proxyConnectHeader.Clone(),
+	}
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	if proxyURL.User != nil && req.Header.Get("Proxy-Authorization") == "" {
+		password, _ := proxyURL.User.Password()
+		creds := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send proxy CONNECT request: %w", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read proxy CONNECT response: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT request failed: %s", resp.Status)
+	}
+	if br.Buffered() > 0 {
+		conn.Close()
+		return nil, fmt.Errorf("proxy sent unexpected data after CONNECT response")
+	}
+
+	return conn, nil
+}
+
+// withDialTimeout wraps a transport's dial function so that websocket connections are bounded by the
+// client's timeout rather than the transport's own dialer settings.
+func withDialTimeout(dial func(ctx context.Context, network, addr string) (net.Conn, error), timeout time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return dial(ctx, network, addr)
+	}
+}
@@ -0,0 +1,104 @@
+package mistclient
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Templates of the Mist API endpoints supported by the client, in the form used by the Mist API documentation.
+// They identify endpoints when configuring the client, for example to set per-endpoint cache TTLs.
+const (
+	EndpointSelf            = "/api/v1/self"
+	EndpointSelfAPITokens   = "/api/v1/self/apitokens"
+	EndpointSelfAPIToken    = "/api/v1/self/apitokens/:apitoken_id"
+	EndpointOrgSites        = "/api/v1/orgs/:org_id/sites"
+	EndpointOrgTicketsCount = "/api/v1/orgs/:org_id/tickets/count"
+	EndpointOrgAlarmsCount  = "/api/v1/orgs/:org_id/alarms/count"
+	EndpointOrgDevices      = "/api/v1/orgs/:org_id/devices"
+	EndpointOrgAPITokens    = "/api/v1/orgs/:org_id/apitokens"
+	EndpointOrgAPIToken     = "/api/v1/orgs/:org_id/apitokens/:apitoken_id"
+	EndpointSiteStats       = "/api/v1/sites/:site_id/stats"
+	EndpointSiteDevices     = "/api/v1/sites/:site_id/devices"
+	EndpointSiteDeviceStats = "/api/v1/sites/:site_id/stats/devices"
+	EndpointSiteClientStats = "/api/v1/sites/:site_id/stats/clients"
+)
+
+// endpoints lists the known endpoint templates, including those used for session authentication.
+var endpoints = []string{
+	EndpointSelf,
+	EndpointSelfAPITokens,
+	EndpointSelfAPIToken,
+	EndpointOrgSites,
+	EndpointOrgTicketsCount,
+	EndpointOrgAlarmsCount,
+	EndpointOrgDevices,
+	EndpointOrgAPITokens,
+	EndpointOrgAPIToken,
+	EndpointSiteStats,
+	EndpointSiteDevices,
+	EndpointSiteDeviceStats,
+	EndpointSiteClientStats,
+	loginPath,
+	loginTwoFactorPath,
+	logoutPath,
+}
+
+// matchEndpoint returns the endpoint template matching a request path, along with the values of its
+// parameters keyed by name (e.g. "org_id"). It reports false if the path matches no known endpoint.
+func matchEndpoint(path string) (string, map[string]string, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for _, endpoint := range endpoints {
+		parts := strings.Split(strings.Trim(endpoint, "/"), "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+
+		var params map[string]string
+		matched := true
+		for i, part := range parts {
+			if name, ok := strings.CutPrefix(part, ":"); ok && segments[i] != "" {
+				if params == nil {
+					params = make(map[string]string)
+				}
+				params[name] = segments[i]
+				continue
+			}
+			if part != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return endpoint, params, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// requestPath returns the absolute path of a request URL. URLs built with JoinPath from a base URL without
+// a path, such as "https://api.mist.com", have a relative path.
+func requestPath(u *url.URL) string {
+	return "/" + strings.TrimPrefix(u.Path, "/")
+}
+
+// channelParams maps the collection segments of websocket channel names to the names of the identifiers
+// that follow them.
+var channelParams = map[string]string{
+	"orgs":    ":org_id",
+	"sites":   ":site_id",
+	"devices": ":device_id",
+}
+
+// channelTemplate returns the template of a websocket channel name, replacing org, site and device IDs
+// with parameter names, e.g. "/sites/:site_id/stats/devices".
+func channelTemplate(channel string) string {
+	segments := strings.Split(channel, "/")
+	for i := 1; i < len(segments); i++ {
+		if param, ok := channelParams[segments[i-1]]; ok && segments[i] != "" {
+			segments[i] = param
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,29 @@
+package mistclient
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestMatchEndpoint(t *testing.T) {
+	tests := []struct {
+		path       string
+		wantOK     bool
+		wantTmpl   string
+		wantParams map[string]string
+	}{
+		{path: "/api/v1/self", wantOK: true, wantTmpl: EndpointSelf},
+		{path: "/api/v1/orgs/abc/sites", wantOK: true, wantTmpl: EndpointOrgSites, wantParams: map[string]string{"org_id": "abc"}},
+		{path: "/api/v1/orgs/abc/apitokens/def", wantOK: true, wantTmpl: EndpointOrgAPIToken, wantParams: map[string]string{"org_id": "abc", "apitoken_id": "def"}},
+		{path: "/api/v1/sites/xyz/stats/devices", wantOK: true, wantTmpl: EndpointSiteDeviceStats, wantParams: map[string]string{"site_id": "xyz"}},
+		{path: "/api/v1/sites/xyz/unknown", wantOK: false},
+		{path: "/api/v1/orgs//sites", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		tmpl, params, ok := matchEndpoint(tt.path)
+		if ok != tt.wantOK || tmpl != tt.wantTmpl || !maps.Equal(params, tt.wantParams) {
+			t.Errorf("matchEndpoint(%q): expected (%q, %v, %t), got: (%q, %v, %t)", tt.path, tt.wantTmpl, tt.wantParams, tt.wantOK, tmpl, params, ok)
+		}
+	}
+}
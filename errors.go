@@ -0,0 +1,115 @@
+package mistclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// headerRequestID is the response header in which the Mist API reports the ID of a request.
+const headerRequestID = "X-Request-Id"
+
+// Sentinel errors matched by an *APIError with the corresponding HTTP status code, for use with errors.Is.
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrServerError  = errors.New("server error")
+)
+
+// APIError is returned when the Mist API responds with an unexpected HTTP status code.
+//
+// Callers can test for common failure classes with errors.Is, for example errors.Is(err, ErrNotFound),
+// or retrieve the full details with errors.As.
+type APIError struct {
+	StatusCode int
+	Method     string
+	URL        string
+	// Detail and Reason are decoded from the JSON error body returned by the API, where present.
+	Detail string
+	Reason string
+	// Body holds the raw response body when it could not be decoded as a Mist error.
+	Body      string
+	RequestID string
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "API request failed with status %d", e.StatusCode)
+	if e.Method != "" {
+		fmt.Fprintf(&b, " (%s %s)", e.Method, e.URL)
+	}
+
+	var msgs []string
+	for _, m := range []string{e.Detail, e.Reason, e.Body} {
+		if m != "" {
+			msgs = append(msgs, m)
+		}
+	}
+	if len(msgs) > 0 {
+		fmt.Fprintf(&b, ": %s", strings.Join(msgs, ": "))
+	}
+
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, " [request id: %s]", e.RequestID)
+	}
+	return b.String()
+}
+
+// Is reports whether the error matches the sentinel error for its status code.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServerError:
+		return e.StatusCode >= http.StatusInternalServerError
+	default:
+		return false
+	}
+}
+
+// extractError is a convenience method for decoding the response body and returning it as an *APIError.
+// It is typically called when a returned HTTP status code does not match the expected value.
+func extractError(r *http.Response) error {
+	apiErr := &APIError{
+		StatusCode: r.StatusCode,
+		RequestID:  r.Header.Get(headerRequestID),
+	}
+	if r.Request != nil {
+		apiErr.Method = r.Request.Method
+		apiErr.URL = r.Request.URL.String()
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		apiErr.Body = fmt.Sprintf("error reading body: %v", err)
+		return apiErr
+	}
+
+	var mistErr struct {
+		Detail string `json:"detail"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(body, &mistErr); err == nil && (mistErr.Detail != "" || mistErr.Reason != "") {
+		apiErr.Detail = mistErr.Detail
+		apiErr.Reason = mistErr.Reason
+		return apiErr
+	}
+
+	apiErr.Body = strings.TrimSpace(string(body))
+	return apiErr
+}
@@ -0,0 +1,118 @@
+package mistclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIErrorNotFound(t *testing.T) {
+	c := newTestClient(t)
+
+	_, err := c.GetOrgSites("random-org-id")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("APIClient.GetOrgSites(): expected ErrNotFound, got: %v", err)
+	}
+	if errors.Is(err, ErrForbidden) {
+		t.Errorf("APIClient.GetOrgSites(): error unexpectedly matched ErrForbidden")
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("APIClient.GetOrgSites(): expected *APIError, got: %T", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("APIError.StatusCode: expected 404, got: %d", apiErr.StatusCode)
+	}
+	if apiErr.Method != http.MethodGet {
+		t.Errorf("APIError.Method: expected GET, got: %s", apiErr.Method)
+	}
+	if !strings.Contains(apiErr.URL, "/api/v1/orgs/random-org-id/sites") {
+		t.Errorf("APIError.URL: expected org sites URL, got: %s", apiErr.URL)
+	}
+	if !strings.Contains(apiErr.Body, "response data not found") {
+		t.Errorf("APIError.Body: expected raw body, got: %q", apiErr.Body)
+	}
+}
+
+func TestAPIErrorForbidden(t *testing.T) {
+	s := testAPIServer(t)
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "wrongAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	if _, err := c.GetSelf(); !errors.Is(err, ErrForbidden) {
+		t.Errorf("APIClient.GetSelf(): expected ErrForbidden, got: %v", err)
+	}
+}
+
+func TestAPIErrorMistBody(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(headerRequestID, "abc123")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"detail": "Authentication credentials were not provided.", "reason": "missing token"}`))
+	}))
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	_, err = c.GetSelf()
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("APIClient.GetSelf(): expected ErrUnauthorized, got: %v", err)
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("APIClient.GetSelf(): expected *APIError, got: %T", err)
+	}
+	if apiErr.Detail != "Authentication credentials were not provided." {
+		t.Errorf("APIError.Detail: unexpected value: %q", apiErr.Detail)
+	}
+	if apiErr.Reason != "missing token" {
+		t.Errorf("APIError.Reason: unexpected value: %q", apiErr.Reason)
+	}
+	if apiErr.Body != "" {
+		t.Errorf("APIError.Body: expected empty body for decoded error, got: %q", apiErr.Body)
+	}
+	if apiErr.RequestID != "abc123" {
+		t.Errorf("APIError.RequestID: expected abc123, got: %q", apiErr.RequestID)
+	}
+
+	want := "API request failed with status 401 (GET " + s.URL + "/api/v1/self): Authentication credentials were not provided.: missing token [request id: abc123]"
+	if apiErr.Error() != want {
+		t.Errorf("APIError.Error():\n expected %q\n got      %q", want, apiErr.Error())
+	}
+}
+
+func TestAPIErrorIs(t *testing.T) {
+	tests := []struct {
+		status int
+		target error
+	}{
+		{http.StatusBadRequest, ErrBadRequest},
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusForbidden, ErrForbidden},
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusTooManyRequests, ErrRateLimited},
+		{http.StatusBadGateway, ErrServerError},
+	}
+
+	for _, tt := range tests {
+		var err error = &APIError{StatusCode: tt.status}
+		if !errors.Is(err, tt.target) {
+			t.Errorf("errors.Is(APIError{%d}, %v): expected true", tt.status, tt.target)
+		}
+		if tt.target != ErrNotFound && errors.Is(err, ErrNotFound) {
+			t.Errorf("errors.Is(APIError{%d}, ErrNotFound): expected false", tt.status)
+		}
+	}
+}
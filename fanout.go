@@ -0,0 +1,119 @@
+package mistclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DefaultFanOutConcurrency is the number of sites processed at once by org-wide helpers such as
+// CollectOrgDeviceStats, and by ForEachSite when given a concurrency below 1.
+const DefaultFanOutConcurrency = 8
+
+// SiteError reports the failure of an operation on a single site during an org-wide fan-out.
+type SiteError struct {
+	SiteID   string
+	SiteName string
+	Err      error
+}
+
+// Error implements the error interface.
+func (e *SiteError) Error() string {
+	return fmt.Sprintf("site %s (%s): %v", e.SiteID, e.SiteName, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *SiteError) Unwrap() error {
+	return e.Err
+}
+
+// ForEachSite calls fn for every site within an organisation, with at most concurrency calls in progress
+// at once. The site list is fetched in full before any site is dispatched, so no response is held open
+// while fn runs. Every request made by fn passes through the client's rate limiter and token pool as
+// usual, so the concurrency bounds parallelism, not request rate.
+//
+// A failing site does not stop the others. ForEachSite returns once every dispatched call has completed,
+// with the errors of the failed sites, each a *SiteError, joined by errors.Join. Should the site list not
+// be fetched, that error is returned and no sites are dispatched; should the context be done, its error is
+// included and no further sites are dispatched.
+func (c *APIClient) ForEachSite(ctx context.Context, orgID string, concurrency int, fn func(ctx context.Context, site Site) error) error {
+	if concurrency < 1 {
+		concurrency = DefaultFanOutConcurrency
+	}
+
+	sites, err := c.OrgSitesPaginator(orgID).Collect(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list sites of org %s: %w", orgID, err)
+	}
+
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}
+
+	sem := make(chan struct{}, concurrency)
+	for _, site := range sites {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			fail(ctx.Err())
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := fn(ctx, site); err != nil {
+				fail(&SiteError{SiteID: site.ID, SiteName: site.Name, Err: err})
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// CollectOrgDeviceStats fetches the device statistics of every site within an organisation, keyed by site
+// ID, fetching up to DefaultFanOutConcurrency sites at once. Results are returned for the sites that
+// succeeded even if others failed, alongside an error joining the failures as described for ForEachSite.
+func (c *APIClient) CollectOrgDeviceStats(ctx context.Context, orgID string) (map[string][]DeviceStat, error) {
+	return collectPerSite(ctx, c, orgID, c.GetSiteDeviceStatsContext)
+}
+
+// CollectOrgClientStats fetches the client statistics of every site within an organisation, keyed by site
+// ID, in the same manner as CollectOrgDeviceStats.
+func (c *APIClient) CollectOrgClientStats(ctx context.Context, orgID string) (map[string][]Client, error) {
+	return collectPerSite(ctx, c, orgID, c.GetSiteClientStatsContext)
+}
+
+// collectPerSite fetches a result for every site within an organisation, keyed by site ID.
+func collectPerSite[T any](ctx context.Context, c *APIClient, orgID string, fetch func(ctx context.Context, siteID string) (T, error)) (map[string]T, error) {
+	var mu sync.Mutex
+	results := make(map[string]T)
+
+	err := c.ForEachSite(ctx, orgID, DefaultFanOutConcurrency, func(ctx context.Context, site Site) error {
+		result, err := fetch(ctx, site.ID)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		results[site.ID] = result
+		return nil
+	})
+
+	return results, err
+}
@@ -0,0 +1,158 @@
+package mistclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testOrgServer returns a server hosting an org with the given number of sites, whose device stats fail
+// for the site named in failing.
+func testOrgServer(t *testing.T, sites int, failing string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/orgs/test-org-id/sites", func(w http.ResponseWriter, r *http.Request) {
+		var list []string
+		for i := range sites {
+			list = append(list, fmt.Sprintf(`{"id": "site-%d", "name": "Site %d"}`, i, i))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[" + strings.Join(list, ",") + "]"))
+	})
+	mux.HandleFunc("/api/v1/sites/{site_id}/stats/devices", func(w http.ResponseWriter, r *http.Request) {
+		siteID := r.PathValue("site_id")
+		if siteID == failing {
+			http.Error(w, `{"detail": "internal error"}`, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `[{"mac": "%s-ap", "site_id": "%s"}]`, siteID, siteID)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestForEachSite(t *testing.T) {
+	s := testOrgServer(t, 10, "")
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	var calls, running, peak atomic.Int32
+	err = c.ForEachSite(context.Background(), "test-org-id", 3, func(ctx context.Context, site Site) error {
+		calls.Add(1)
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		if site.ID == "site-4" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	if n := calls.Load(); n != 10 {
+		t.Errorf("APIClient.ForEachSite(): expected 10 calls, got: %d", n)
+	}
+	if p := peak.Load(); p > 3 {
+		t.Errorf("APIClient.ForEachSite(): expected at most 3 concurrent calls, got: %d", p)
+	}
+
+	var siteErr *SiteError
+	if !errors.As(err, &siteErr) || siteErr.SiteID != "site-4" || siteErr.SiteName != "Site 4" {
+		t.Errorf("APIClient.ForEachSite(): expected a *SiteError for site-4, got: %v", err)
+	}
+}
+
+func TestForEachSiteCancelled(t *testing.T) {
+	s := testOrgServer(t, 10, "")
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls atomic.Int32
+	err = c.ForEachSite(ctx, "test-org-id", 1, func(ctx context.Context, site Site) error {
+		calls.Add(1)
+		cancel()
+		return nil
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("APIClient.ForEachSite(): expected context.Canceled, got: %v", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("APIClient.ForEachSite(): expected no sites to be dispatched after cancellation, got %d calls", n)
+	}
+}
+
+func TestForEachSiteSlowCallback(t *testing.T) {
+	s := testOrgServer(t, 20, "")
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey", Timeout: 200 * time.Millisecond}, nil)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	// The sites take far longer to process than the client's timeout allows for a single request.
+	var calls atomic.Int32
+	err = c.ForEachSite(context.Background(), "test-org-id", 2, func(ctx context.Context, site Site) error {
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+
+	if err != nil {
+		t.Errorf("APIClient.ForEachSite(): unexpected error: %v", err)
+	}
+	if n := calls.Load(); n != 20 {
+		t.Errorf("APIClient.ForEachSite(): expected 20 calls, got: %d", n)
+	}
+}
+
+func TestCollectOrgDeviceStats(t *testing.T) {
+	s := testOrgServer(t, 5, "site-2")
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	stats, err := c.CollectOrgDeviceStats(context.Background(), "test-org-id")
+
+	if !errors.Is(err, ErrServerError) {
+		t.Errorf("APIClient.CollectOrgDeviceStats(): expected ErrServerError, got: %v", err)
+	}
+	var siteErr *SiteError
+	if !errors.As(err, &siteErr) || siteErr.SiteID != "site-2" {
+		t.Errorf("APIClient.CollectOrgDeviceStats(): expected a *SiteError for site-2, got: %v", err)
+	}
+
+	if len(stats) != 4 {
+		t.Fatalf("APIClient.CollectOrgDeviceStats(): expected partial results for 4 sites, got: %d", len(stats))
+	}
+	if _, ok := stats["site-2"]; ok {
+		t.Errorf("APIClient.CollectOrgDeviceStats(): expected no results for the failed site")
+	}
+	if devices := stats["site-3"]; len(devices) != 1 || devices[0].Mac != "site-3-ap" {
+		t.Errorf("APIClient.CollectOrgDeviceStats(): expected 1 device for site-3, got: %+v", devices)
+	}
+}
@@ -0,0 +1,150 @@
+package mistclient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// DefaultKeepaliveInterval is how often a websocket connection is pinged, unless set with WithKeepalive.
+const DefaultKeepaliveInterval = 30 * time.Second
+
+// DefaultIdleTimeout is how long a websocket connection may go without receiving anything, including the
+// responses to keepalive pings, before it is considered stale, unless set with WithIdleTimeout.
+const DefaultIdleTimeout = 90 * time.Second
+
+// ErrStaleConnection is reported when a websocket connection is torn down for having received nothing within
+// its idle timeout, such as when the connection is half-open.
+var ErrStaleConnection = errors.New("websocket connection stale")
+
+// WithKeepalive sets how often a ping is sent over each websocket connection of a subscription. Mist answers
+// each with a pong, so that a quiet but healthy connection is not mistaken for a stale one. Zero or a
+// negative interval disables keepalive pings.
+func WithKeepalive(interval time.Duration) SubscribeOption {
+	return func(so *subscribeOptions) {
+		so.keepalive = interval
+	}
+}
+
+// WithIdleTimeout sets how long a websocket connection may go without receiving any message or pong before
+// it is considered stale. A stale connection is closed and, like a lost connection, re-established if the
+// subscription was made with WithReconnect, or otherwise ends its subscriptions with ErrStaleConnection.
+// While the connection's reading is held up by a slow subscriber under OverflowBlock, it is not considered
+// idle. Zero or a negative timeout disables stale detection.
+func WithIdleTimeout(timeout time.Duration) SubscribeOption {
+	return func(so *subscribeOptions) {
+		so.idleTimeout = timeout
+	}
+}
+
+// activityConn wraps a network connection, recording when data was last read from it.
+type activityConn struct {
+	net.Conn
+	lastRead atomic.Int64
+}
+
+// newActivityConn wraps a connection, treating it as active from now.
+func newActivityConn(conn net.Conn) *activityConn {
+	a := &activityConn{Conn: conn}
+	a.lastRead.Store(time.Now().UnixNano())
+	return a
+}
+
+// Read implements the io.Reader interface.
+func (a *activityConn) Read(p []byte) (int, error) {
+	n, err := a.Conn.Read(p)
+	if n > 0 {
+		a.lastRead.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// idle returns how long it has been since data was last read from the connection.
+func (a *activityConn) idle() time.Duration {
+	return time.Since(time.Unix(0, a.lastRead.Load()))
+}
+
+// watch pings one of the shard's connections every keepalive interval, and closes it should nothing be
+// received within the idle timeout, until the connection is lost.
+func (sh *wsShard) watch(conn *websocket.Conn, activity *activityConn, lost <-chan struct{}) {
+	s := sh.s
+	defer s.wg.Done()
+
+	keepalive, idleTimeout := s.so.keepalive, s.so.idleTimeout
+	period := keepalive
+	if idleTimeout > 0 && (period <= 0 || idleTimeout/2 < period) {
+		period = idleTimeout / 2
+	}
+	if period <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	var lastPing time.Time
+	for {
+		select {
+		case <-lost:
+			return
+		case <-ticker.C:
+		}
+
+		if idle := sh.idle(activity); idleTimeout > 0 && idle >= idleTimeout {
+			s.c.logger.Warn("websocket connection stale, closing", "idle", idle, "idle_timeout", idleTimeout)
+			sh.mu.Lock()
+			sh.stale = fmt.Errorf("%w: nothing received for %s", ErrStaleConnection, idle.Round(time.Millisecond))
+			sh.mu.Unlock()
+			// Close the network connection directly, as a half-open connection may not accept a close frame.
+			activity.Close()
+			return
+		}
+
+		if keepalive > 0 && time.Since(lastPing) >= keepalive {
+			if err := sh.ping(conn); err != nil {
+				s.c.logger.Debug("failed to send websocket ping", "error", err)
+			}
+			lastPing = time.Now()
+		}
+	}
+}
+
+// idle returns how long one of the shard's connections has gone without receiving anything, discounting
+// time during which it was not being read because a delivery was blocked on a slow subscriber.
+func (sh *wsShard) idle(activity *activityConn) time.Duration {
+	if sh.blocked.Load() > 0 {
+		return 0
+	}
+	return min(activity.idle(), time.Since(time.Unix(0, sh.unblocked.Load())))
+}
+
+// block records that a delivery is waiting on a slow subscriber, holding up the reading of the connection.
+func (sh *wsShard) block() {
+	sh.blocked.Add(1)
+}
+
+// unblock records the end of a delivery's wait on a slow subscriber.
+func (sh *wsShard) unblock() {
+	sh.unblocked.Store(time.Now().UnixNano())
+	sh.blocked.Add(-1)
+}
+
+// ping sends a ping frame over one of the shard's connections.
+func (sh *wsShard) ping(conn *websocket.Conn) error {
+	sh.writeMu.Lock()
+	defer sh.writeMu.Unlock()
+
+	conn.SetWriteDeadline(time.Now().Add(sh.s.c.timeout))
+	defer conn.SetWriteDeadline(time.Time{})
+
+	conn.PayloadType = websocket.PingFrame
+	defer func() {
+		conn.PayloadType = websocket.TextFrame
+	}()
+	_, err := conn.Write(nil)
+	return err
+}
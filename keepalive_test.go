@@ -0,0 +1,175 @@
+package mistclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// testStallingWebsocketServer returns a websocket server which subscribes the client and sends a single
+// message numbered by connection. The first `stalled` connections then go silent, neither reading nor
+// answering pings as a half-open connection would, until release is closed. Later connections keep reading,
+// answering pings, but send nothing further.
+func testStallingWebsocketServer(t *testing.T, stalled int32, release <-chan struct{}) *httptest.Server {
+	t.Helper()
+	var connections atomic.Int32
+	return httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+		n := connections.Add(1)
+
+		var subReq SubscriptionRequest
+		if err := websocket.JSON.Receive(ws, &subReq); err != nil {
+			return
+		}
+		websocket.JSON.Send(ws, SubscriptionResponse{Event: "channel_subscribed", Channel: subReq.Subscribe})
+		websocket.JSON.Send(ws, WebsocketMessage{Event: "data", Channel: subReq.Subscribe, Data: fmt.Sprintf("message %d", n)})
+
+		if n <= stalled {
+			<-release
+			return
+		}
+		for {
+			var req map[string]any
+			if err := websocket.JSON.Receive(ws, &req); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func TestSubscribeStaleConnectionReconnects(t *testing.T) {
+	release := make(chan struct{})
+	s := testStallingWebsocketServer(t, 1, release)
+	defer s.Close()
+	defer close(release)
+	c := newWebsocketTestClient(t, s)
+
+	var (
+		mu     sync.Mutex
+		causes []error
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msgs, err := c.Subscribe(ctx, "/sites/test-site-id/stats/devices",
+		WithKeepalive(10*time.Millisecond),
+		WithIdleTimeout(50*time.Millisecond),
+		WithReconnect(testReconnectPolicy),
+		WithReconnectHandler(func(e ReconnectEvent) {
+			if !e.Reconnected {
+				mu.Lock()
+				defer mu.Unlock()
+				causes = append(causes, e.Err)
+			}
+		}))
+	if err != nil {
+		t.Fatalf("APIClient.Subscribe(): unexpected error: %v", err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		if msg := receive(t, msgs); msg.Data != fmt.Sprintf("message %d", i) {
+			t.Errorf("APIClient.Subscribe(): expected message %d, got: %+v", i, msg)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(causes) != 1 || !errors.Is(causes[0], ErrStaleConnection) {
+		t.Errorf("ReconnectEvent: expected a single reconnection caused by ErrStaleConnection, got: %v", causes)
+	}
+}
+
+func TestSubscribeStaleConnectionEnds(t *testing.T) {
+	release := make(chan struct{})
+	s := testStallingWebsocketServer(t, 1, release)
+	defer s.Close()
+	defer close(release)
+	c := newWebsocketTestClient(t, s)
+
+	msgs, err := c.Subscribe(context.Background(), "/sites/test-site-id/stats/devices",
+		WithKeepalive(10*time.Millisecond),
+		WithIdleTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("APIClient.Subscribe(): unexpected error: %v", err)
+	}
+
+	receive(t, msgs)
+	expectClosed(t, msgs)
+}
+
+func TestSubscribeKeepalive(t *testing.T) {
+	release := make(chan struct{})
+	s := testStallingWebsocketServer(t, 0, release)
+	defer s.Close()
+	defer close(release)
+	c := newWebsocketTestClient(t, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msgs, err := c.Subscribe(ctx, "/sites/test-site-id/stats/devices",
+		WithKeepalive(10*time.Millisecond),
+		WithIdleTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("APIClient.Subscribe(): unexpected error: %v", err)
+	}
+	receive(t, msgs)
+
+	// The server sends nothing further, but answers pings, so the quiet connection is kept open.
+	select {
+	case msg, ok := <-msgs:
+		t.Fatalf("APIClient.Subscribe(): expected a quiet subscription to remain open, got: %+v (open: %t)", msg, ok)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	cancel()
+	expectClosed(t, msgs)
+}
+
+func TestSubscribeBlockedNotStale(t *testing.T) {
+	s := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		var subReq SubscriptionRequest
+		if err := websocket.JSON.Receive(ws, &subReq); err != nil {
+			return
+		}
+		websocket.JSON.Send(ws, SubscriptionResponse{Event: "channel_subscribed", Channel: subReq.Subscribe})
+		for i := range 5 {
+			websocket.JSON.Send(ws, WebsocketMessage{Event: "data", Channel: subReq.Subscribe, Data: fmt.Sprintf("message %d", i)})
+		}
+		for {
+			var req map[string]any
+			if err := websocket.JSON.Receive(ws, &req); err != nil {
+				return
+			}
+		}
+	}))
+	defer s.Close()
+	c := newWebsocketTestClient(t, s)
+
+	sub, err := c.Subscription(context.Background(), "/sites/test-site-id/stats/devices",
+		WithBuffer(1),
+		WithKeepalive(10*time.Millisecond),
+		WithIdleTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("APIClient.Subscription(): unexpected error: %v", err)
+	}
+	defer sub.Close()
+
+	// The subscriber falls behind for longer than the idle timeout, blocking the reading of the connection.
+	time.Sleep(300 * time.Millisecond)
+	for i := range 5 {
+		if msg := receive(t, sub.C); msg.Data != fmt.Sprintf("message %d", i) {
+			t.Errorf("Subscription.C: expected message %d, got: %+v", i, msg)
+		}
+	}
+	if err := sub.Err(); err != nil {
+		t.Errorf("Subscription.Err(): expected a backpressured connection to remain open, got: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package mistclient
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// unknownEndpoint labels measurements of requests to endpoints without a known template.
+const unknownEndpoint = "unknown"
+
+// Metrics receives measurements of the client's own behaviour, for exposition by a metrics system.
+// Implementations must be safe for concurrent use. PrometheusMetrics is a ready-made implementation.
+//
+// REST measurements are labelled with the endpoint template (e.g. EndpointOrgSites), or "unknown", and
+// websocket measurements with the channel template (e.g. "/sites/:site_id/stats/devices"), so that label
+// cardinality does not grow with the number of orgs and sites.
+type Metrics interface {
+	// ObserveRequest records a completed REST request attempt. The status is zero if no response was received.
+	ObserveRequest(endpoint, method string, status int, duration time.Duration)
+	// AddBytesReceived records the size of a REST response body.
+	AddBytesReceived(endpoint string, n int)
+	// IncRetries records a retried REST request attempt.
+	IncRetries(endpoint string)
+	// IncRateLimited records a 429 response.
+	IncRateLimited(endpoint string)
+	// AddWebsocketConnections adjusts the number of open websocket connections.
+	AddWebsocketConnections(delta int)
+	// AddSubscriptions adjusts the number of active websocket subscriptions.
+	AddSubscriptions(delta int)
+	// IncMessagesDropped records a websocket message that was discarded before delivery.
+	IncMessagesDropped(channel string)
+	// IncDecodeErrors records a websocket message that could not be decoded.
+	IncDecodeErrors(channel string)
+	// IncReconnects records a resilient subscription re-established after its connection was lost.
+	IncReconnects(channel string)
+}
+
+// noopMetrics is the default Metrics implementation, which discards all measurements.
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveRequest(string, string, int, time.Duration) {}
+func (noopMetrics) AddBytesReceived(string, int)                      {}
+func (noopMetrics) IncRetries(string)                                 {}
+func (noopMetrics) IncRateLimited(string)                             {}
+func (noopMetrics) AddWebsocketConnections(int)                       {}
+func (noopMetrics) AddSubscriptions(int)                              {}
+func (noopMetrics) IncMessagesDropped(string)                         {}
+func (noopMetrics) IncDecodeErrors(string)                            {}
+func (noopMetrics) IncReconnects(string)                              {}
+
+// WithMetrics sets the Metrics implementation that receives measurements of the client's behaviour.
+func WithMetrics(m Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// instrument is middleware that records the outcome and latency of each request attempt, measured until
+// the response headers are received, and the size of the response body once it has been read and closed.
+func (c *APIClient) instrument(next Handler) Handler {
+	return func(r *Request) (*http.Response, error) {
+		endpoint := r.Endpoint
+		if endpoint == "" {
+			endpoint = unknownEndpoint
+		}
+		if r.Attempt > 1 {
+			c.metrics.IncRetries(endpoint)
+		}
+
+		start := time.Now()
+		resp, err := next(r)
+		if err != nil {
+			c.metrics.ObserveRequest(endpoint, r.Method, 0, time.Since(start))
+			return nil, err
+		}
+		c.metrics.ObserveRequest(endpoint, r.Method, resp.StatusCode, time.Since(start))
+		resp.Body = &countedBody{ReadCloser: resp.Body, done: func(n int) {
+			c.metrics.AddBytesReceived(endpoint, n)
+		}}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			c.metrics.IncRateLimited(endpoint)
+		}
+
+		return resp, nil
+	}
+}
+
+// countedBody is a response body that counts the bytes read from it, reporting the count on Close.
+type countedBody struct {
+	io.ReadCloser
+	done func(n int)
+
+	n    int
+	once sync.Once
+}
+
+// Read implements io.Reader.
+func (b *countedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += n
+	return n, err
+}
+
+// Close implements io.Closer.
+func (b *countedBody) Close() error {
+	b.once.Do(func() {
+		b.done(b.n)
+	})
+	return b.ReadCloser.Close()
+}
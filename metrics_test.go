@@ -0,0 +1,108 @@
+package mistclient
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMetricsREST(t *testing.T) {
+	var requests atomic.Int32
+	s := testFlakyServer(t, 1, http.StatusTooManyRequests, &requests)
+	defer s.Close()
+
+	m := NewPrometheusMetrics()
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey", Retry: RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}}, nil,
+		WithMetrics(m))
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	if _, err := c.GetSiteStats("test-site-id"); err != nil {
+		t.Fatalf("APIClient.GetSiteStats(): unexpected error: %v", err)
+	}
+
+	var b strings.Builder
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatalf("PrometheusMetrics.WriteTo(): unexpected error: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		`mistclient_requests_total{endpoint="/api/v1/sites/:site_id/stats",method="GET",status="200"} 1`,
+		`mistclient_requests_total{endpoint="/api/v1/sites/:site_id/stats",method="GET",status="429"} 1`,
+		`mistclient_request_duration_seconds_count{endpoint="/api/v1/sites/:site_id/stats",method="GET",status="200"} 1`,
+		`mistclient_response_bytes_total{endpoint="/api/v1/sites/:site_id/stats"} 2`,
+		`mistclient_retries_total{endpoint="/api/v1/sites/:site_id/stats"} 1`,
+		`mistclient_rate_limited_total{endpoint="/api/v1/sites/:site_id/stats"} 1`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("PrometheusMetrics.WriteTo(): expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestMetricsWebsocket(t *testing.T) {
+	wsServer := testWebsocketServer(t, false, `{"mac": "5c5b35000001"}`, `not json`)
+	defer wsServer.Close()
+
+	m := NewPrometheusMetrics()
+	c, err := New(&Config{BaseURL: "https://mist-proxy.example.com", WebsocketURL: "ws" + wsServer.URL[len("http"):], APIKey: "testAPIKey"}, nil,
+		WithMetrics(m))
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stats, err := c.StreamSiteDeviceStats(ctx, "test-site-id")
+	if err != nil {
+		t.Fatalf("APIClient.StreamSiteDeviceStats(): unexpected error: %v", err)
+	}
+	<-stats
+
+	m.mu.Lock()
+	connections, subscriptions := m.connections, m.subscriptions
+	m.mu.Unlock()
+	if connections != 1 || subscriptions != 1 {
+		t.Errorf("Metrics: expected 1 connection and subscription, got: %v and %v", connections, subscriptions)
+	}
+
+	cancel()
+	for range stats {
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var b strings.Builder
+		m.WriteTo(&b)
+		out := b.String()
+		if strings.Contains(out, "mistclient_websocket_connections 0\n") && strings.Contains(out, "mistclient_subscriptions 0\n") {
+			if want := `mistclient_message_decode_errors_total{channel="/sites/:site_id/stats/devices"} 1`; !strings.Contains(out, want) {
+				t.Errorf("Metrics: expected output to contain %q, got:\n%s", want, out)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Metrics: expected connections and subscriptions to return to 0, got:\n%s", out)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestChannelTemplate(t *testing.T) {
+	tests := map[string]string{
+		"/sites/d96e3952-53e8-4266-959a-45acd55f5114/stats/devices": "/sites/:site_id/stats/devices",
+		"/orgs/9ff00eec/sites/abc/devices":                          "/orgs/:org_id/sites/:site_id/devices",
+		"/sites/abc/devices/5c5b35000001/cmd":                       "/sites/:site_id/devices/:device_id/cmd",
+	}
+	for channel, want := range tests {
+		if got := channelTemplate(channel); got != want {
+			t.Errorf("channelTemplate(%q): expected %q, got: %q", channel, want, got)
+		}
+	}
+}
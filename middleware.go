@@ -0,0 +1,216 @@
+package mistclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Request is an API request as it passes through the middleware chain. It embeds the outgoing HTTP request,
+// whose headers middleware may modify, and describes the Mist endpoint it addresses.
+type Request struct {
+	*http.Request
+
+	// Endpoint is the template of the endpoint addressed, e.g. EndpointOrgSites, or empty if it is not known.
+	Endpoint string
+	// Params holds the values of the endpoint's path parameters, keyed by name (e.g. "org_id").
+	Params map[string]string
+	// OrgID and SiteID are the org and site addressed by the request, if any.
+	OrgID  string
+	SiteID string
+	// Attempt is the 1-based number of this attempt at the request, which exceeds 1 when retrying.
+	Attempt int
+
+	data  []byte
+	token string
+}
+
+// Handler sends an API request and returns its response.
+type Handler func(*Request) (*http.Response, error)
+
+// Middleware wraps a Handler to add behaviour around the sending of API requests, such as metrics, auditing,
+// header injection or fault injection. A middleware may inspect or modify the request before calling next,
+// inspect the response afterwards, or return a response or error of its own without calling next.
+//
+// Middleware runs once per attempt, so a retried request passes through it again with a higher Attempt.
+// It sees requests after they have been authenticated and cleared by the rate limiter, and responses whose
+// body is streamed from the network, so middleware that reads the body must replace it.
+type Middleware func(next Handler) Handler
+
+// WithMiddleware adds middleware to the chain wrapping REST requests. Middleware is applied in the order
+// given, so the first wraps the second, and so on.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(o *options) {
+		o.middleware = append(o.middleware, mw...)
+	}
+}
+
+// buildHandler assembles the middleware chain around the HTTP client: authentication, rate limiting and
+// trace propagation outermost, then any user middleware, then trace logging, metrics and body capture.
+func (c *APIClient) buildHandler(mw []Middleware) Handler {
+	chain := append([]Middleware{c.authenticate, c.throttle, c.propagateTrace}, mw...)
+	chain = append(chain, c.traceLog, c.instrument, c.captureBody)
+
+	h := c.roundTrip
+	for i := len(chain) - 1; i >= 0; i-- {
+		h = chain[i](h)
+	}
+	return h
+}
+
+// newRequest builds a Request for the given endpoint, carrying any additional headers.
+func (c *APIClient) newRequest(ctx context.Context, method string, u *url.URL, data []byte, header http.Header) (*Request, error) {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	r := &Request{Request: req, Attempt: 1, data: data}
+	if endpoint, params, ok := matchEndpoint(requestPath(u)); ok {
+		r.Endpoint = endpoint
+		r.Params = params
+		r.OrgID = params["org_id"]
+		r.SiteID = params["site_id"]
+	}
+
+	return r, nil
+}
+
+// roundTrip sends a request with the HTTP client, terminating the middleware chain.
+func (c *APIClient) roundTrip(r *Request) (*http.Response, error) {
+	return c.client.Do(r.Request)
+}
+
+// authenticate is middleware that authenticates a request with an API token from the pool or, in session
+// mode, the session's CSRF token.
+func (c *APIClient) authenticate(next Handler) Handler {
+	return func(r *Request) (*http.Response, error) {
+		if !c.session.enabled.Load() {
+			ctx, cancel := c.waitContext(r.Context())
+			token, err := c.tokens.acquire(ctx)
+			cancel()
+			if err != nil {
+				return nil, err
+			}
+			r.token = token
+		}
+		c.setAuthHeaders(r.Header, r.Method, r.token)
+
+		return next(r)
+	}
+}
+
+// throttle is middleware that holds requests back within the client-side request budget, and on a 429
+// response either retires the exhausted token or pauses all requests until Retry-After has elapsed.
+func (c *APIClient) throttle(next Handler) Handler {
+	return func(r *Request) (*http.Response, error) {
+		ctx, cancel := c.waitContext(r.Context())
+		err := c.limiter.wait(ctx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := next(r)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+			return resp, err
+		}
+
+		if c.tokens.size() > 1 && r.token != "" {
+			// Withdraw only the exhausted token, leaving the remainder of the pool in service.
+			until := quotaReset(resp, time.Now())
+			c.logger.Warn("API rate limit exceeded, retiring token", "token", maskToken(r.token), "until", until)
+			c.tokens.retire(r.token, until)
+		} else {
+			until := retryAfter(resp.Header, time.Now())
+			c.logger.Warn("API rate limit exceeded, pausing requests", "until", until)
+			c.limiter.block(until)
+		}
+
+		return resp, nil
+	}
+}
+
+// waitContext returns the context bounding the client-side waits of a request before it is sent. A request
+// whose context has no deadline, such as one made by the methods without a Context suffix, waits for no
+// longer than the client's timeout, which would otherwise bound only the request itself.
+func (c *APIClient) waitContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// traceLog is middleware that logs requests and responses, including their bodies, at TRACE level.
+func (c *APIClient) traceLog(next Handler) Handler {
+	return func(r *Request) (*http.Response, error) {
+		c.logger.Trace("making API request", "method", r.Method, "url", r.URL.String(), "headers", r.Header)
+		if r.data != nil {
+			c.logger.Trace("api request body", "body", string(r.data))
+		}
+
+		resp, err := next(r)
+		if err != nil {
+			c.logger.Error("request failed", "error", err)
+			return nil, err
+		}
+		c.logger.Trace("api response received", "status", resp.StatusCode)
+
+		return resp, nil
+	}
+}
+
+// captureBody is middleware that, when TRACE logging is enabled, captures the response body as the caller
+// reads it and logs it once the body is closed. Otherwise the body is streamed from the network untouched.
+func (c *APIClient) captureBody(next Handler) Handler {
+	return func(r *Request) (*http.Response, error) {
+		resp, err := next(r)
+		if err != nil || !c.logger.Enabled(r.Context(), LevelTrace) {
+			return resp, err
+		}
+
+		resp.Body = &capturedBody{ReadCloser: resp.Body, logger: c.logger}
+
+		return resp, nil
+	}
+}
+
+// capturedBody is a response body that records what is read from it, logging it at TRACE level on Close.
+type capturedBody struct {
+	io.ReadCloser
+	logger *Logger
+
+	buf  bytes.Buffer
+	once sync.Once
+}
+
+// Read implements io.Reader.
+func (b *capturedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	return n, err
+}
+
+// Close implements io.Closer.
+func (b *capturedBody) Close() error {
+	b.once.Do(func() {
+		b.logger.Trace("api response body", "body", b.buf.String())
+	})
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,115 @@
+package mistclient
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	var requests atomic.Int32
+	s := testFlakyServer(t, 1, http.StatusServiceUnavailable, &requests)
+	defer s.Close()
+
+	var (
+		order    []string
+		seen     []Request
+		injected string
+	)
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(r *Request) (*http.Response, error) {
+				order = append(order, name)
+				return next(r)
+			}
+		}
+	}
+	audit := func(next Handler) Handler {
+		return func(r *Request) (*http.Response, error) {
+			r.Header.Set("X-Audit-Id", "job-42")
+			seen = append(seen, *r)
+			resp, err := next(r)
+			if err == nil {
+				injected = resp.Request.Header.Get("X-Audit-Id")
+			}
+			return resp, err
+		}
+	}
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey", Retry: RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}}, nil,
+		WithMiddleware(record("first"), record("second"), audit))
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	if _, err := c.GetOrgAPIToken("test-org-id", "test-token-id"); err != nil {
+		t.Fatalf("APIClient.GetOrgAPIToken(): unexpected error: %v", err)
+	}
+
+	if got := strings.Join(order, ","); got != "first,second,first,second" {
+		t.Errorf("Middleware: expected order 'first,second,first,second', got: %s", got)
+	}
+	if len(seen) != 2 {
+		t.Fatalf("Middleware: expected 2 attempts, got: %d", len(seen))
+	}
+	for i, r := range seen {
+		if r.Endpoint != EndpointOrgAPIToken || r.OrgID != "test-org-id" || r.Params["apitoken_id"] != "test-token-id" {
+			t.Errorf("Middleware: unexpected endpoint details: %q %q %v", r.Endpoint, r.OrgID, r.Params)
+		}
+		if r.Attempt != i+1 {
+			t.Errorf("Middleware: expected attempt %d, got: %d", i+1, r.Attempt)
+		}
+		if r.Header.Get("Authorization") != "Token testAPIKey" {
+			t.Errorf("Middleware: expected an authenticated request, got Authorization: %q", r.Header.Get("Authorization"))
+		}
+	}
+	if injected != "job-42" {
+		t.Errorf("Middleware: expected injected header to be sent, got: %q", injected)
+	}
+}
+
+func TestMiddlewareFaultInjection(t *testing.T) {
+	var requests atomic.Int32
+	s := testFlakyServer(t, 0, http.StatusOK, &requests)
+	defer s.Close()
+
+	errInjected := errors.New("injected fault")
+	fault := func(next Handler) Handler {
+		return func(r *Request) (*http.Response, error) {
+			if r.SiteID == "broken-site" {
+				return nil, errInjected
+			}
+			if r.Endpoint == EndpointSelf {
+				return &http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+					Header:     http.Header{},
+					Body:       io.NopCloser(strings.NewReader(`{"detail": "injected outage"}`)),
+					Request:    r.Request,
+				}, nil
+			}
+			return next(r)
+		}
+	}
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil, WithMiddleware(fault))
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	if _, err := c.GetSiteStats("broken-site"); !errors.Is(err, errInjected) {
+		t.Errorf("APIClient.GetSiteStats(): expected injected error, got: %v", err)
+	}
+	if _, err := c.GetSelf(); !errors.Is(err, ErrServerError) {
+		t.Errorf("APIClient.GetSelf(): expected ErrServerError, got: %v", err)
+	}
+	if _, err := c.GetSiteStats("test-site-id"); err != nil {
+		t.Errorf("APIClient.GetSiteStats(): unexpected error: %v", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("Middleware: expected only the unfaulted request to reach the server, got: %d", got)
+	}
+}
@@ -139,6 +139,30 @@ type Org struct {
 	CreatedTime     UnixTime `json:"created_time,omitzero"`
 }
 
+// OrgAPIToken represents an API token issued by an organization. The full Key is only returned when the token is created.
+type OrgAPIToken struct {
+	ID           string      `json:"id,omitempty"`
+	Name         string      `json:"name,omitempty"`
+	Key          string      `json:"key,omitempty"`
+	OrgID        string      `json:"org_id,omitempty"`
+	CreatedBy    string      `json:"created_by,omitempty"`
+	Privileges   []Privilege `json:"privileges,omitempty"`
+	SrcIPs       []string    `json:"src_ips,omitempty"`
+	LastUsed     UnixTime    `json:"last_used,omitzero"`
+	ModifiedTime UnixTime    `json:"modified_time,omitzero"`
+	CreatedTime  UnixTime    `json:"created_time,omitzero"`
+}
+
+// SelfAPIToken represents an API token issued to the authenticated user, carrying the user's privileges.
+// The full Key is only returned when the token is created.
+type SelfAPIToken struct {
+	ID          string   `json:"id,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Key         string   `json:"key,omitempty"`
+	LastUsed    UnixTime `json:"last_used,omitzero"`
+	CreatedTime UnixTime `json:"created_time,omitzero"`
+}
+
 // OrgStat holds operational statistics and data relating to an org
 type OrgStat struct {
 	NumAps                int `json:"num_aps,omitempty"`
@@ -0,0 +1,83 @@
+package mistclient
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures optional behaviour of an APIClient. Options are passed to New.
+type Option func(*options)
+
+// options holds the settings accumulated from the Options passed to New.
+type options struct {
+	httpClient *http.Client
+	transport  http.RoundTripper
+	userAgent  string
+	tlsConfig  *tls.Config
+	proxy      func(*http.Request) (*url.URL, error)
+	retry      *RetryPolicy
+	cache      *CacheConfig
+	middleware []Middleware
+	metrics    Metrics
+	redaction  *RedactionPolicy
+
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+}
+
+// WithHTTPClient sets the HTTP client used for REST requests. The client is copied, so later changes
+// to it have no effect. Its Timeout is used as-is, overriding Config.Timeout for REST requests.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = hc
+	}
+}
+
+// WithTransport sets the transport used for REST requests, for example to customise connection pooling
+// or to wrap requests with instrumentation.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = rt
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with REST requests and the websocket handshake.
+func WithUserAgent(ua string) Option {
+	return func(o *options) {
+		o.userAgent = ua
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used for REST requests and websocket connections, for example
+// to trust a custom CA bundle. It requires the transport in use to be an *http.Transport.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = cfg
+	}
+}
+
+// WithProxy sets the function used to select a proxy for REST requests and websocket connections, such as
+// http.ProxyURL or http.ProxyFromEnvironment. It requires the transport in use to be an *http.Transport.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(o *options) {
+		o.proxy = proxy
+	}
+}
+
+// WithRetryPolicy sets the retry policy for idempotent requests, overriding Config.Retry.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = &policy
+	}
+}
+
+// WithCache enables the response cache with the given configuration, overriding Config.Cache.
+func WithCache(config CacheConfig) Option {
+	return func(o *options) {
+		o.cache = &config
+	}
+}
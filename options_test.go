@@ -0,0 +1,248 @@
+package mistclient
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// roundTripperFunc adapts a function to the http.RoundTripper interface.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// testConnectProxy creates a test HTTP proxy, served over TLS if secure, which tunnels CONNECT requests
+// to upstream regardless of the requested target, and records each CONNECT request.
+func testConnectProxy(t *testing.T, upstream string, secure bool) (*httptest.Server, func() []*http.Request) {
+	t.Helper()
+
+	var (
+		mu       sync.Mutex
+		requests []*http.Request
+	)
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, r)
+		mu.Unlock()
+
+		upConn, err := net.Dial("tcp", upstream)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			upConn.Close()
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			io.Copy(upConn, conn)
+			upConn.Close()
+		}()
+		io.Copy(conn, upConn)
+		conn.Close()
+	}))
+	if secure {
+		s.StartTLS()
+	} else {
+		s.Start()
+	}
+
+	return s, func() []*http.Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*http.Request(nil), requests...)
+	}
+}
+
+func TestWithUserAgent(t *testing.T) {
+	var ua string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua = r.Header.Get("User-Agent")
+		w.Write([]byte("{}"))
+	}))
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil, WithUserAgent("mist-exporter/1.2.3"))
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	if _, err := c.GetSelf(); err != nil {
+		t.Fatalf("APIClient.GetSelf(): unexpected error: %v", err)
+	}
+	if ua != "mist-exporter/1.2.3" {
+		t.Errorf("WithUserAgent: expected User-Agent 'mist-exporter/1.2.3', got: %q", ua)
+	}
+}
+
+func TestWithTransport(t *testing.T) {
+	s := testAPIServer(t)
+	defer s.Close()
+
+	var calls int
+	rt := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		return http.DefaultTransport.RoundTrip(r)
+	})
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil, WithTransport(rt))
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	if _, err := c.GetSelf(); err != nil {
+		t.Fatalf("APIClient.GetSelf(): unexpected error: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("WithTransport: expected 1 call through the custom transport, got: %d", calls)
+	}
+
+	if _, err := New(&Config{BaseURL: s.URL}, nil, WithTransport(rt), WithTLSConfig(&tls.Config{})); err == nil {
+		t.Error("New: expected error combining WithTLSConfig with a non-*http.Transport, got nil")
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	hc := &http.Client{Timeout: 42 * time.Second}
+
+	c, err := New(&Config{BaseURL: "https://api.mist.com"}, nil, WithHTTPClient(hc))
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	if c.client == hc {
+		t.Error("WithHTTPClient: expected the HTTP client to be copied")
+	}
+	if c.client.Timeout != 42*time.Second {
+		t.Errorf("WithHTTPClient: expected Timeout 42s, got: %s", c.client.Timeout)
+	}
+}
+
+func TestWithTLSConfig(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	if _, err := c.GetSelf(); err == nil {
+		t.Error("APIClient.GetSelf(): expected certificate verification error without custom TLS config, got nil")
+	}
+
+	tlsConfig := s.Client().Transport.(*http.Transport).TLSClientConfig
+	c, err = New(&Config{BaseURL: s.URL}, nil, WithTLSConfig(tlsConfig))
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	if _, err := c.GetSelf(); err != nil {
+		t.Errorf("APIClient.GetSelf(): unexpected error with custom TLS config: %v", err)
+	}
+}
+
+func TestWithProxyWebsocket(t *testing.T) {
+	var ua string
+	wsServer := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		ua = ws.Request().Header.Get("User-Agent")
+		var subReq SubscriptionRequest
+		if err := websocket.JSON.Receive(ws, &subReq); err != nil {
+			return
+		}
+		websocket.JSON.Send(ws, SubscriptionResponse{Event: "channel_subscribed", Channel: subReq.Subscribe})
+		websocket.JSON.Receive(ws, &UnsubscribeRequest{})
+	}))
+	defer wsServer.Close()
+
+	proxy, requests := testConnectProxy(t, wsServer.Listener.Addr().String(), false)
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	// The websocket host does not resolve, so the connection can only succeed through the proxy.
+	c, err := New(&Config{BaseURL: "http://api.mistclient.invalid", APIKey: "testAPIKey"}, nil,
+		WithProxy(http.ProxyURL(proxyURL)), WithUserAgent("mist-exporter/1.2.3"))
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if _, err := c.Subscribe(ctx, "/sites/test-site-id/stats/devices"); err != nil {
+		t.Fatalf("APIClient.Subscribe(): unexpected error: %v", err)
+	}
+	if got := requests(); len(got) != 1 || got[0].Host != "api-ws.mistclient.invalid:80" {
+		t.Errorf("WithProxy: expected a single CONNECT to api-ws.mistclient.invalid:80, got: %v", got)
+	}
+	if ua != "mist-exporter/1.2.3" {
+		t.Errorf("WithUserAgent: expected websocket User-Agent 'mist-exporter/1.2.3', got: %q", ua)
+	}
+}
+
+func TestWithProxyWebsocketHTTPS(t *testing.T) {
+	wsServer := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		var subReq SubscriptionRequest
+		if err := websocket.JSON.Receive(ws, &subReq); err != nil {
+			return
+		}
+		websocket.JSON.Send(ws, SubscriptionResponse{Event: "channel_subscribed", Channel: subReq.Subscribe})
+		websocket.JSON.Receive(ws, &UnsubscribeRequest{})
+	}))
+	defer wsServer.Close()
+
+	proxy, requests := testConnectProxy(t, wsServer.Listener.Addr().String(), true)
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("proxy-user", "proxy-pass")
+
+	tlsConfig := proxy.Client().Transport.(*http.Transport).TLSClientConfig
+	c, err := New(&Config{BaseURL: "http://api.mistclient.invalid", APIKey: "testAPIKey"}, nil,
+		WithProxy(http.ProxyURL(proxyURL)), WithTLSConfig(tlsConfig))
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if _, err := c.Subscribe(ctx, "/sites/test-site-id/stats/devices"); err != nil {
+		t.Fatalf("APIClient.Subscribe(): unexpected error: %v", err)
+	}
+	got := requests()
+	if len(got) != 1 || got[0].Host != "api-ws.mistclient.invalid:80" {
+		t.Fatalf("WithProxy: expected a single CONNECT to api-ws.mistclient.invalid:80, got: %v", got)
+	}
+	if user, pass, ok := (&http.Request{Header: http.Header{"Authorization": got[0].Header["Proxy-Authorization"]}}).BasicAuth(); !ok || user != "proxy-user" || pass != "proxy-pass" {
+		t.Errorf("WithProxy: expected Proxy-Authorization for proxy-user, got: %q", got[0].Header.Get("Proxy-Authorization"))
+	}
+}
+
+func TestWithProxyWebsocketUnsupportedScheme(t *testing.T) {
+	proxyURL, _ := url.Parse("socks5://proxy.mistclient.invalid:1080")
+	c, err := New(&Config{BaseURL: "http://api.mistclient.invalid", APIKey: "testAPIKey"}, nil,
+		WithProxy(http.ProxyURL(proxyURL)))
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	_, err = c.Subscribe(context.Background(), "/sites/test-site-id/stats/devices")
+	if err == nil || !strings.Contains(err.Error(), `unsupported proxy scheme: "socks5"`) {
+		t.Errorf("APIClient.Subscribe(): expected an unsupported proxy scheme error, got: %v", err)
+	}
+}
@@ -1,33 +1,40 @@
 package mistclient
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"iter"
 	"net/http"
 )
 
 // GetOrgSites returns a list of all sites configured within an organisation.
 func (c *APIClient) GetOrgSites(orgID string) ([]Site, error) {
-	resp, err := c.Get(c.baseURL.JoinPath(fmt.Sprintf("/api/v1/orgs/%s/sites", orgID)))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+	return c.GetOrgSitesContext(context.Background(), orgID)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, extractError(resp)
-	}
+// GetOrgSitesContext is like GetOrgSites but bound to the supplied context.
+func (c *APIClient) GetOrgSitesContext(ctx context.Context, orgID string) ([]Site, error) {
+	return c.OrgSitesPaginator(orgID).Collect(ctx)
+}
 
-	var sites []Site
-	if err := json.NewDecoder(resp.Body).Decode(&sites); err != nil {
-		return nil, err
-	}
+// OrgSitesPaginator returns a Paginator over the sites configured within an organisation.
+func (c *APIClient) OrgSitesPaginator(orgID string) *Paginator[Site] {
+	return newPaginator(c, c.baseURL.JoinPath(fmt.Sprintf("/api/v1/orgs/%s/sites", orgID)), decodeList[Site])
+}
 
-	return sites, nil
+// AllOrgSites returns an iterator over the sites configured within an organisation, fetching pages lazily.
+func (c *APIClient) AllOrgSites(ctx context.Context, orgID string) iter.Seq2[Site, error] {
+	return c.OrgSitesPaginator(orgID).All(ctx)
 }
 
 // CountOrgTickets returns a map of counts of all tickets related to an organisation, keyed by their status.
 func (c *APIClient) CountOrgTickets(orgID string) (map[TicketStatus]int, error) {
+	return c.CountOrgTicketsContext(context.Background(), orgID)
+}
+
+// CountOrgTicketsContext is like CountOrgTickets but bound to the supplied context.
+func (c *APIClient) CountOrgTicketsContext(ctx context.Context, orgID string) (map[TicketStatus]int, error) {
 	u := c.baseURL.JoinPath(fmt.Sprintf("/api/v1/orgs/%s/tickets/count", orgID))
 
 	q := u.Query()
@@ -35,7 +42,7 @@ func (c *APIClient) CountOrgTickets(orgID string) (map[TicketStatus]int, error)
 
 	u.RawQuery = q.Encode()
 
-	resp, err := c.Get(u)
+	resp, err := c.GetContext(ctx, u)
 	if err != nil {
 		return nil, err
 	}
@@ -65,6 +72,11 @@ func (c *APIClient) CountOrgTickets(orgID string) (map[TicketStatus]int, error)
 
 // CountOrgAlarms returns a map of counts of all alarms related to an organisation, keyed by their type.
 func (c *APIClient) CountOrgAlarms(orgID string) (map[string]int, error) {
+	return c.CountOrgAlarmsContext(context.Background(), orgID)
+}
+
+// CountOrgAlarmsContext is like CountOrgAlarms but bound to the supplied context.
+func (c *APIClient) CountOrgAlarmsContext(ctx context.Context, orgID string) (map[string]int, error) {
 	u := c.baseURL.JoinPath(fmt.Sprintf("/api/v1/orgs/%s/alarms/count", orgID))
 
 	q := u.Query()
@@ -72,7 +84,7 @@ func (c *APIClient) CountOrgAlarms(orgID string) (map[string]int, error) {
 
 	u.RawQuery = q.Encode()
 
-	resp, err := c.Get(u)
+	resp, err := c.GetContext(ctx, u)
 	if err != nil {
 		return nil, err
 	}
@@ -102,7 +114,42 @@ func (c *APIClient) CountOrgAlarms(orgID string) (map[string]int, error) {
 
 // ListOrgDevices returns a map of device MAC addresses to names.
 func (c *APIClient) ListOrgDevices(orgID string) (map[string]string, error) {
-	resp, err := c.Get(c.baseURL.JoinPath(fmt.Sprintf("/api/v1/orgs/%s/devices", orgID)))
+	return c.ListOrgDevicesContext(context.Background(), orgID)
+}
+
+// ListOrgDevicesContext is like ListOrgDevices but bound to the supplied context.
+func (c *APIClient) ListOrgDevicesContext(ctx context.Context, orgID string) (map[string]string, error) {
+	results, err := c.OrgDevicesPaginator(orgID).Collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make(map[string]string, len(results))
+	for _, d := range results {
+		devices[d.Mac] = d.Name
+	}
+
+	return devices, nil
+}
+
+// OrgDevicesPaginator returns a Paginator over the devices assigned to an organisation.
+func (c *APIClient) OrgDevicesPaginator(orgID string) *Paginator[Device] {
+	return newPaginator(c, c.baseURL.JoinPath(fmt.Sprintf("/api/v1/orgs/%s/devices", orgID)), decodeResults[Device])
+}
+
+// AllOrgDevices returns an iterator over the devices assigned to an organisation, fetching pages lazily.
+func (c *APIClient) AllOrgDevices(ctx context.Context, orgID string) iter.Seq2[Device, error] {
+	return c.OrgDevicesPaginator(orgID).All(ctx)
+}
+
+// ListOrgAPITokens returns the API tokens issued by an organisation. Token keys are masked.
+func (c *APIClient) ListOrgAPITokens(orgID string) ([]OrgAPIToken, error) {
+	return c.ListOrgAPITokensContext(context.Background(), orgID)
+}
+
+// ListOrgAPITokensContext is like ListOrgAPITokens but bound to the supplied context.
+func (c *APIClient) ListOrgAPITokensContext(ctx context.Context, orgID string) ([]OrgAPIToken, error) {
+	resp, err := c.GetContext(ctx, c.baseURL.JoinPath(fmt.Sprintf("/api/v1/orgs/%s/apitokens", orgID)))
 	if err != nil {
 		return nil, err
 	}
@@ -112,21 +159,101 @@ func (c *APIClient) ListOrgDevices(orgID string) (map[string]string, error) {
 		return nil, extractError(resp)
 	}
 
-	result := struct {
-		Results []struct {
-			Mac  string `json:"mac"`
-			Name string `json:"name"`
-		} `json:"results"`
-	}{}
+	var tokens []OrgAPIToken
+	err = json.NewDecoder(resp.Body).Decode(&tokens)
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+	return tokens, err
+}
+
+// GetOrgAPIToken returns an API token issued by an organisation. The token key is masked.
+func (c *APIClient) GetOrgAPIToken(orgID, tokenID string) (OrgAPIToken, error) {
+	return c.GetOrgAPITokenContext(context.Background(), orgID, tokenID)
+}
+
+// GetOrgAPITokenContext is like GetOrgAPIToken but bound to the supplied context.
+func (c *APIClient) GetOrgAPITokenContext(ctx context.Context, orgID, tokenID string) (OrgAPIToken, error) {
+	var token OrgAPIToken
+
+	resp, err := c.GetContext(ctx, c.baseURL.JoinPath(fmt.Sprintf("/api/v1/orgs/%s/apitokens/%s", orgID, tokenID)))
+	if err != nil {
+		return token, err
 	}
+	defer resp.Body.Close()
 
-	devices := make(map[string]string, len(result.Results))
-	for _, d := range result.Results {
-		devices[d.Mac] = d.Name
+	if resp.StatusCode != http.StatusOK {
+		return token, extractError(resp)
 	}
 
-	return devices, nil
+	err = json.NewDecoder(resp.Body).Decode(&token)
+
+	return token, err
+}
+
+// CreateOrgAPIToken issues a new API token for an organisation, with the name, privileges and source IP
+// restrictions of the given token. The returned token holds the full key, which cannot be retrieved later.
+func (c *APIClient) CreateOrgAPIToken(orgID string, token OrgAPIToken) (OrgAPIToken, error) {
+	return c.CreateOrgAPITokenContext(context.Background(), orgID, token)
+}
+
+// CreateOrgAPITokenContext is like CreateOrgAPIToken but bound to the supplied context.
+func (c *APIClient) CreateOrgAPITokenContext(ctx context.Context, orgID string, token OrgAPIToken) (OrgAPIToken, error) {
+	var created OrgAPIToken
+
+	resp, err := c.PostContext(ctx, c.baseURL.JoinPath(fmt.Sprintf("/api/v1/orgs/%s/apitokens", orgID)), token)
+	if err != nil {
+		return created, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return created, extractError(resp)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&created)
+
+	return created, err
+}
+
+// UpdateOrgAPIToken updates the name, privileges and source IP restrictions of an organisation's API token.
+func (c *APIClient) UpdateOrgAPIToken(orgID, tokenID string, token OrgAPIToken) (OrgAPIToken, error) {
+	return c.UpdateOrgAPITokenContext(context.Background(), orgID, tokenID, token)
+}
+
+// UpdateOrgAPITokenContext is like UpdateOrgAPIToken but bound to the supplied context.
+func (c *APIClient) UpdateOrgAPITokenContext(ctx context.Context, orgID, tokenID string, token OrgAPIToken) (OrgAPIToken, error) {
+	var updated OrgAPIToken
+
+	resp, err := c.PutContext(ctx, c.baseURL.JoinPath(fmt.Sprintf("/api/v1/orgs/%s/apitokens/%s", orgID, tokenID)), token)
+	if err != nil {
+		return updated, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return updated, extractError(resp)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&updated)
+
+	return updated, err
+}
+
+// DeleteOrgAPIToken revokes an API token issued by an organisation.
+func (c *APIClient) DeleteOrgAPIToken(orgID, tokenID string) error {
+	return c.DeleteOrgAPITokenContext(context.Background(), orgID, tokenID)
+}
+
+// DeleteOrgAPITokenContext is like DeleteOrgAPIToken but bound to the supplied context.
+func (c *APIClient) DeleteOrgAPITokenContext(ctx context.Context, orgID, tokenID string) error {
+	resp, err := c.DeleteContext(ctx, c.baseURL.JoinPath(fmt.Sprintf("/api/v1/orgs/%s/apitokens/%s", orgID, tokenID)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return extractError(resp)
+	}
+
+	return nil
 }
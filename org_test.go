@@ -1,6 +1,13 @@
 package mistclient
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -57,3 +64,135 @@ func TestCountOrgAlarms(t *testing.T) {
 		t.Errorf("Client.CountOrgAlarms(%s): expected 1 'device_down' alarm, got: %d", orgID, alarmCounts["device_down"])
 	}
 }
+
+// testAPITokenServer creates a test server that mimics the Mist API token endpoints under the given path,
+// storing tokens in memory. Keys are returned in full only on creation.
+func testAPITokenServer(t *testing.T, path string) *httptest.Server {
+	t.Helper()
+
+	var (
+		mu     sync.Mutex
+		next   int
+		tokens = map[string]map[string]any{}
+	)
+	mask := func(token map[string]any) map[string]any {
+		masked := make(map[string]any, len(token))
+		for k, v := range token {
+			masked[k] = v
+		}
+		masked["key"] = "****" + token["key"].(string)[len(token["key"].(string))-4:]
+		return masked
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, path), "/")
+		switch {
+		case !strings.HasPrefix(r.URL.Path, path):
+			http.NotFound(w, r)
+		case id == "" && r.Method == http.MethodGet:
+			list := []map[string]any{}
+			for _, token := range tokens {
+				list = append(list, mask(token))
+			}
+			json.NewEncoder(w).Encode(list)
+		case id == "" && r.Method == http.MethodPost:
+			var token map[string]any
+			if err := json.NewDecoder(r.Body).Decode(&token); err != nil {
+				http.Error(w, `{"detail": "invalid body"}`, http.StatusBadRequest)
+				return
+			}
+			next++
+			token["id"] = fmt.Sprintf("token-%d", next)
+			token["key"] = fmt.Sprintf("secret-key-%04d", next)
+			token["created_time"] = 1700000000
+			tokens[token["id"].(string)] = token
+			json.NewEncoder(w).Encode(token)
+		case tokens[id] == nil:
+			http.Error(w, `{"detail": "token not found"}`, http.StatusNotFound)
+		case r.Method == http.MethodGet:
+			json.NewEncoder(w).Encode(mask(tokens[id]))
+		case r.Method == http.MethodPut:
+			var update map[string]any
+			if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+				http.Error(w, `{"detail": "invalid body"}`, http.StatusBadRequest)
+				return
+			}
+			for k, v := range update {
+				if k != "id" && k != "key" {
+					tokens[id][k] = v
+				}
+			}
+			json.NewEncoder(w).Encode(mask(tokens[id]))
+		case r.Method == http.MethodDelete:
+			delete(tokens, id)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func TestOrgAPITokens(t *testing.T) {
+	orgID := "test-org-id"
+	s := testAPITokenServer(t, "/api/v1/orgs/"+orgID+"/apitokens")
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	created, err := c.CreateOrgAPIToken(orgID, OrgAPIToken{
+		Name:       "ci-job",
+		Privileges: []Privilege{{Scope: "site", Role: "read", SiteID: "test-site-id"}},
+		SrcIPs:     []string{"192.0.2.0/24"},
+	})
+	if err != nil {
+		t.Fatalf("APIClient.CreateOrgAPIToken(): unexpected error: %v", err)
+	}
+	if created.ID == "" || created.Key != "secret-key-0001" {
+		t.Errorf("APIClient.CreateOrgAPIToken(): expected ID and full key, got: %+v", created)
+	}
+	if len(created.Privileges) != 1 || created.Privileges[0].SiteID != "test-site-id" || created.Privileges[0].Role != "read" {
+		t.Errorf("APIClient.CreateOrgAPIToken(): unexpected privileges: %+v", created.Privileges)
+	}
+	if created.CreatedTime.Unix() != 1700000000 {
+		t.Errorf("APIClient.CreateOrgAPIToken(): expected created time 1700000000, got: %d", created.CreatedTime.Unix())
+	}
+
+	tokens, err := c.ListOrgAPITokens(orgID)
+	if err != nil {
+		t.Fatalf("APIClient.ListOrgAPITokens(): unexpected error: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].ID != created.ID || tokens[0].Key != "****0001" {
+		t.Errorf("APIClient.ListOrgAPITokens(): expected one masked token, got: %+v", tokens)
+	}
+
+	updated, err := c.UpdateOrgAPIToken(orgID, created.ID, OrgAPIToken{Name: "ci-job-renamed", Privileges: created.Privileges})
+	if err != nil {
+		t.Fatalf("APIClient.UpdateOrgAPIToken(): unexpected error: %v", err)
+	}
+	if updated.Name != "ci-job-renamed" {
+		t.Errorf("APIClient.UpdateOrgAPIToken(): expected name 'ci-job-renamed', got: %s", updated.Name)
+	}
+
+	token, err := c.GetOrgAPIToken(orgID, created.ID)
+	if err != nil {
+		t.Fatalf("APIClient.GetOrgAPIToken(): unexpected error: %v", err)
+	}
+	if token.Name != "ci-job-renamed" || len(token.SrcIPs) != 1 {
+		t.Errorf("APIClient.GetOrgAPIToken(): unexpected token: %+v", token)
+	}
+
+	if err := c.DeleteOrgAPIToken(orgID, created.ID); err != nil {
+		t.Fatalf("APIClient.DeleteOrgAPIToken(): unexpected error: %v", err)
+	}
+	if _, err := c.GetOrgAPIToken(orgID, created.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("APIClient.GetOrgAPIToken(): expected ErrNotFound after deletion, got: %v", err)
+	}
+	if err := c.DeleteOrgAPIToken(orgID, created.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("APIClient.DeleteOrgAPIToken(): expected ErrNotFound for revoked token, got: %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package mistclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+// DefaultPageLimit is the number of results requested per page by a Paginator, unless overridden with WithLimit.
+const DefaultPageLimit = 100
+
+// Pagination response headers returned by the Mist API on list and search endpoints.
+const (
+	headerPageTotal = "X-Page-Total"
+	headerPageLimit = "X-Page-Limit"
+)
+
+// Paginator fetches the results of a paginated Mist API endpoint one page at a time.
+//
+// Pages are requested with the `limit` and `page` query parameters. The total number of results is
+// taken from the X-Page-Total response header where the API reports it; otherwise the final page is
+// detected by it containing fewer results than the requested limit. Pagination also ends on an empty page,
+// or on a page beginning with the same result as the previous page, as returned by an endpoint that ignores
+// the `page` parameter.
+//
+// A Paginator is not safe for concurrent use.
+type Paginator[T any] struct {
+	c      *APIClient
+	u      *url.URL
+	decode decodeFunc[T]
+
+	limit   int
+	page    int
+	total   int
+	fetched int
+	done    bool
+
+	first    T
+	hasFirst bool
+}
+
+// decodeFunc decodes a page of results from r as it is read, passing each result to yield until it
+// returns false. It returns the number of results decoded.
+type decodeFunc[T any] func(r io.Reader, yield func(T) bool) (int, error)
+
+// newPaginator returns a Paginator for the endpoint at u, decoding each page of results with decode.
+func newPaginator[T any](c *APIClient, u *url.URL, decode decodeFunc[T]) *Paginator[T] {
+	return &Paginator[T]{
+		c:      c,
+		u:      u,
+		decode: decode,
+		limit:  DefaultPageLimit,
+		page:   1,
+		total:  -1,
+	}
+}
+
+// decodeList decodes a page of results returned as a bare JSON array, one element at a time.
+func decodeList[T any](r io.Reader, yield func(T) bool) (int, error) {
+	return decodeArray(json.NewDecoder(r), yield)
+}
+
+// decodeResults decodes a page of results wrapped in a `results` object, as returned by search endpoints,
+// one element at a time. Other fields of the object are skipped.
+func decodeResults[T any](r io.Reader, yield func(T) bool) (int, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return n, err
+		}
+		if key, _ := tok.(string); key != "results" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return n, err
+			}
+			continue
+		}
+		stopped := false
+		n, err = decodeArray(dec, func(result T) bool {
+			stopped = !yield(result)
+			return !stopped
+		})
+		if err != nil || stopped {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// decodeArray decodes a JSON array from dec one element at a time, passing each to yield until it returns
+// false. A null in place of the array is treated as empty. It returns the number of elements decoded.
+func decodeArray[T any](dec *json.Decoder, yield func(T) bool) (int, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return 0, err
+	}
+	if tok == nil {
+		return 0, nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return 0, fmt.Errorf("expected JSON array, got: %v", tok)
+	}
+
+	n := 0
+	for dec.More() {
+		var v T
+		if err := dec.Decode(&v); err != nil {
+			return n, err
+		}
+		n++
+		if !yield(v) {
+			return n, nil
+		}
+	}
+
+	return n, expectDelim(dec, ']')
+}
+
+// expectDelim reads the next token from dec, which must be the given delimiter.
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("expected %q in JSON, got: %v", want, tok)
+	}
+	return nil
+}
+
+// WithLimit sets the number of results requested per page. It must be called before the first page is fetched.
+func (p *Paginator[T]) WithLimit(limit int) *Paginator[T] {
+	if limit > 0 {
+		p.limit = limit
+	}
+	return p
+}
+
+// Total returns the total number of results reported by the API, or -1 if it is not yet known.
+// The total becomes known once the first page has been fetched from an endpoint that reports it.
+func (p *Paginator[T]) Total() int {
+	return p.total
+}
+
+// HasNext reports whether there may be further pages to fetch.
+func (p *Paginator[T]) HasNext() bool {
+	return !p.done
+}
+
+// Next fetches and returns the next page of results. Once all pages have been fetched, HasNext returns false.
+//
+// The page is decoded in full and its response body closed before Next returns, so the time taken to
+// process the results does not count against the client's timeout.
+func (p *Paginator[T]) Next(ctx context.Context) ([]T, error) {
+	if p.done {
+		return nil, nil
+	}
+
+	u := *p.u
+	q := u.Query()
+	q.Set("limit", strconv.Itoa(p.limit))
+	q.Set("page", strconv.Itoa(p.page))
+	u.RawQuery = q.Encode()
+
+	resp, err := p.c.GetContext(ctx, &u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, extractError(resp)
+	}
+
+	var results []T
+	repeated := false
+	n, err := p.decode(resp.Body, func(result T) bool {
+		if len(results) == 0 {
+			if p.hasFirst && reflect.DeepEqual(result, p.first) {
+				// The endpoint has returned the previous page again, so there is nothing further to fetch.
+				repeated = true
+				return false
+			}
+			p.first, p.hasFirst = result, true
+		}
+		results = append(results, result)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode page %d: %w", p.page, err)
+	}
+
+	if repeated {
+		p.c.logger.Warn("paginated endpoint repeated the previous page, stopping", "url", p.u.String(), "page", p.page)
+		p.done = true
+		return nil, nil
+	}
+
+	p.advance(resp.Header, n)
+
+	return results, nil
+}
+
+// advance records the outcome of fetching a page of n results and determines whether further pages remain.
+func (p *Paginator[T]) advance(h http.Header, n int) {
+	limit := p.limit
+	if v, err := strconv.Atoi(h.Get(headerPageLimit)); err == nil && v > 0 {
+		// The API may cap the requested limit, so honour the limit it reports.
+		limit = v
+	}
+	if v, err := strconv.Atoi(h.Get(headerPageTotal)); err == nil && v >= 0 {
+		p.total = v
+	}
+
+	p.page++
+	p.fetched += n
+
+	switch {
+	case n == 0, n < limit:
+		p.done = true
+	case p.total >= 0 && p.fetched >= p.total:
+		p.done = true
+	}
+}
+
+// Collect fetches every remaining page and returns the combined results.
+func (p *Paginator[T]) Collect(ctx context.Context) ([]T, error) {
+	var all []T
+	for p.HasNext() {
+		results, err := p.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, results...)
+	}
+	return all, nil
+}
+
+// All returns an iterator over every remaining result. Pages are fetched lazily as the caller ranges
+// over the iterator, one page at a time: each page is decoded in full and its response body closed before
+// its results are yielded, so at most one page is held in memory and a slow loop body does not hold a
+// connection open. Stopping iteration part-way through a page discards the remainder of that page.
+//
+// If fetching or decoding a page fails, the error is yielded alongside the zero value of T and iteration stops.
+func (p *Paginator[T]) All(ctx context.Context) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for p.HasNext() {
+			results, err := p.Next(ctx)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, result := range results {
+				if !yield(result, nil) {
+					return
+				}
+			}
+		}
+	}
+}
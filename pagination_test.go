@@ -0,0 +1,344 @@
+package mistclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testPagingServer creates a test server that serves numSites sites from the org sites endpoint,
+// honouring the limit and page query parameters and optionally reporting the X-Page-Total header.
+func testPagingServer(t *testing.T, numSites int, reportTotal bool) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil {
+			t.Errorf("testPagingServer: invalid limit parameter: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil {
+			t.Errorf("testPagingServer: invalid page parameter: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		sites := []Site{}
+		for i := (page - 1) * limit; i < page*limit && i < numSites; i++ {
+			sites = append(sites, Site{ID: fmt.Sprintf("site-%d", i)})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(headerPageLimit, strconv.Itoa(limit))
+		if reportTotal {
+			w.Header().Set(headerPageTotal, strconv.Itoa(numSites))
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(sites)
+	}))
+}
+
+func TestPaginatorAll(t *testing.T) {
+	tests := []struct {
+		name        string
+		numSites    int
+		limit       int
+		reportTotal bool
+	}{
+		{name: "Single partial page", numSites: 3, limit: 10, reportTotal: true},
+		{name: "Multiple pages with total", numSites: 25, limit: 10, reportTotal: true},
+		{name: "Exact multiple with total", numSites: 20, limit: 10, reportTotal: true},
+		{name: "Multiple pages without total", numSites: 25, limit: 10},
+		{name: "Exact multiple without total", numSites: 20, limit: 10},
+		{name: "Empty", numSites: 0, limit: 10, reportTotal: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testPagingServer(t, tt.numSites, tt.reportTotal)
+			defer s.Close()
+
+			c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+			if err != nil {
+				t.Fatalf("New: unexpected error: %v", err)
+			}
+
+			p := c.OrgSitesPaginator("test-org-id").WithLimit(tt.limit)
+			sites, err := p.Collect(context.Background())
+			if err != nil {
+				t.Fatalf("Paginator.Collect(): unexpected error: %v", err)
+			}
+			if len(sites) != tt.numSites {
+				t.Fatalf("Paginator.Collect(): expected %d sites, got: %d", tt.numSites, len(sites))
+			}
+			for i, site := range sites {
+				if want := fmt.Sprintf("site-%d", i); site.ID != want {
+					t.Errorf("Paginator.Collect()[%d].ID: expected %s, got: %s", i, want, site.ID)
+				}
+			}
+			if tt.reportTotal && p.Total() != tt.numSites {
+				t.Errorf("Paginator.Total(): expected %d, got: %d", tt.numSites, p.Total())
+			}
+			if !tt.reportTotal && p.Total() != -1 {
+				t.Errorf("Paginator.Total(): expected -1, got: %d", p.Total())
+			}
+		})
+	}
+}
+
+func TestPaginatorNext(t *testing.T) {
+	s := testPagingServer(t, 5, true)
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	p := c.OrgSitesPaginator("test-org-id").WithLimit(2)
+	if p.Total() != -1 {
+		t.Errorf("Paginator.Total(): expected -1 before first page, got: %d", p.Total())
+	}
+
+	var sizes []int
+	for p.HasNext() {
+		page, err := p.Next(context.Background())
+		if err != nil {
+			t.Fatalf("Paginator.Next(): unexpected error: %v", err)
+		}
+		sizes = append(sizes, len(page))
+	}
+	if len(sizes) != 3 || sizes[0] != 2 || sizes[1] != 2 || sizes[2] != 1 {
+		t.Errorf("Paginator.Next(): expected page sizes [2 2 1], got: %v", sizes)
+	}
+	if p.Total() != 5 {
+		t.Errorf("Paginator.Total(): expected 5, got: %d", p.Total())
+	}
+}
+
+func TestPaginatorRepeatedPage(t *testing.T) {
+	var requests atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Ignore the page parameter, returning a full first page every time.
+		if requests.Add(1) > 10 {
+			t.Errorf("Paginator: expected pagination to stop, got %d requests", requests.Load())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]Site{{ID: "site-0"}, {ID: "site-1"}})
+	}))
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	t.Run("Collect", func(t *testing.T) {
+		requests.Store(0)
+		sites, err := c.OrgSitesPaginator("test-org-id").WithLimit(2).Collect(context.Background())
+		if err != nil {
+			t.Fatalf("Paginator.Collect(): unexpected error: %v", err)
+		}
+		if len(sites) != 2 {
+			t.Errorf("Paginator.Collect(): expected the repeated page to be ignored, got %d sites", len(sites))
+		}
+		if n := requests.Load(); n != 2 {
+			t.Errorf("Paginator.Collect(): expected 2 requests, got: %d", n)
+		}
+	})
+
+	t.Run("All", func(t *testing.T) {
+		requests.Store(0)
+		var ids []string
+		for site, err := range c.OrgSitesPaginator("test-org-id").WithLimit(2).All(context.Background()) {
+			if err != nil {
+				t.Fatalf("Paginator.All(): unexpected error: %v", err)
+			}
+			ids = append(ids, site.ID)
+		}
+		if len(ids) != 2 || ids[0] != "site-0" || ids[1] != "site-1" {
+			t.Errorf("Paginator.All(): expected [site-0 site-1], got: %v", ids)
+		}
+	})
+}
+
+func TestGetOrgSitesPaginated(t *testing.T) {
+	s := testPagingServer(t, 250, true)
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	sites, err := c.GetOrgSites("test-org-id")
+	if err != nil {
+		t.Fatalf("APIClient.GetOrgSites(): unexpected error: %v", err)
+	}
+	if len(sites) != 250 {
+		t.Errorf("APIClient.GetOrgSites(): expected 250 sites across pages, got: %d", len(sites))
+	}
+}
+
+func TestPaginatorAllIterator(t *testing.T) {
+	var requests atomic.Int32
+	s := testPagingServer(t, 25, true)
+	defer s.Close()
+
+	counting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		s.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer counting.Close()
+
+	c, err := New(&Config{BaseURL: counting.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	var ids []string
+	for site, err := range c.OrgSitesPaginator("test-org-id").WithLimit(10).All(context.Background()) {
+		if err != nil {
+			t.Fatalf("Paginator.All(): unexpected error: %v", err)
+		}
+		ids = append(ids, site.ID)
+		if len(ids) == 12 {
+			break
+		}
+	}
+	if len(ids) != 12 || ids[11] != "site-11" {
+		t.Errorf("Paginator.All(): expected 12 sites ending with site-11, got: %v", ids)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("Paginator.All(): expected 2 page requests before break, got: %d", n)
+	}
+}
+
+func TestAllOrgSitesError(t *testing.T) {
+	c := newTestClient(t)
+
+	var n int
+	for _, err := range c.AllOrgSites(context.Background(), "random-org-id") {
+		n++
+		if err == nil {
+			t.Errorf("APIClient.AllOrgSites(): expected error, got nil")
+		}
+	}
+	if n != 1 {
+		t.Errorf("APIClient.AllOrgSites(): expected a single error yield, got: %d", n)
+	}
+}
+
+func TestAllSiteClients(t *testing.T) {
+	c := newTestClient(t)
+
+	var clients []Client
+	for client, err := range c.AllSiteClients(context.Background(), "test-site-id") {
+		if err != nil {
+			t.Fatalf("APIClient.AllSiteClients(): unexpected error: %v", err)
+		}
+		clients = append(clients, client)
+	}
+	if len(clients) != 1 {
+		t.Fatalf("APIClient.AllSiteClients(): expected 1 client, got: %d", len(clients))
+	}
+	if clients[0].Mac != "5684dae9ac8b" {
+		t.Errorf("APIClient.AllSiteClients()[0].Mac: expected 5684dae9ac8b, got: %s", clients[0].Mac)
+	}
+}
+
+// closeCountingTransport counts the response bodies it has handed out and how many have been closed.
+type closeCountingTransport struct {
+	opened, closed atomic.Int32
+}
+
+func (t *closeCountingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	t.opened.Add(1)
+	resp.Body = &closeCountingBody{ReadCloser: resp.Body, closed: &t.closed}
+	return resp, nil
+}
+
+type closeCountingBody struct {
+	io.ReadCloser
+	closed *atomic.Int32
+	once   sync.Once
+}
+
+func (b *closeCountingBody) Close() error {
+	b.once.Do(func() { b.closed.Add(1) })
+	return b.ReadCloser.Close()
+}
+
+func TestPaginatorAllReleasesPage(t *testing.T) {
+	s := testPagingServer(t, 6, true)
+	defer s.Close()
+
+	transport := &closeCountingTransport{}
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey", Timeout: 300 * time.Millisecond}, nil, WithTransport(transport))
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	var ids []string
+	for site, err := range c.OrgSitesPaginator("test-org-id").WithLimit(3).All(context.Background()) {
+		if err != nil {
+			t.Fatalf("Paginator.All(): unexpected error: %v", err)
+		}
+		if opened, closed := transport.opened.Load(), transport.closed.Load(); opened != closed {
+			t.Errorf("Paginator.All(): expected every response body closed before yielding, got %d of %d", closed, opened)
+		}
+		ids = append(ids, site.ID)
+
+		// A slow consumer takes longer over each page than the client's timeout.
+		time.Sleep(150 * time.Millisecond)
+	}
+
+	if strings.Join(ids, ",") != "site-0,site-1,site-2,site-3,site-4,site-5" {
+		t.Errorf("Paginator.All(): expected sites 'site-0' to 'site-5', got: %v", ids)
+	}
+}
+
+func TestDecodeResults(t *testing.T) {
+	body := `{"start": 0, "results": [{"mac": "a"}, {"mac": "b"}, {"mac": "c"}], "total": 3, "next": null}`
+
+	var macs []string
+	n, err := decodeResults(strings.NewReader(body), func(d Device) bool {
+		macs = append(macs, d.Mac)
+		return true
+	})
+	if err != nil || n != 3 || strings.Join(macs, ",") != "a,b,c" {
+		t.Errorf("decodeResults(): expected 3 devices 'a,b,c', got: %d %v (err: %v)", n, macs, err)
+	}
+
+	macs = nil
+	n, err = decodeResults(strings.NewReader(body), func(d Device) bool {
+		macs = append(macs, d.Mac)
+		return len(macs) < 2
+	})
+	if err != nil || n != 2 || strings.Join(macs, ",") != "a,b" {
+		t.Errorf("decodeResults(): expected to stop after 2 devices, got: %d %v (err: %v)", n, macs, err)
+	}
+
+	if _, err := decodeList(strings.NewReader(`{"detail": "not a list"}`), func(Site) bool { return true }); err == nil {
+		t.Errorf("decodeList(): expected an error for a non-array response")
+	}
+	if n, err := decodeList(strings.NewReader(`null`), func(Site) bool { return true }); err != nil || n != 0 {
+		t.Errorf("decodeList(): expected null to decode as empty, got: %d (err: %v)", n, err)
+	}
+}
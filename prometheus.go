@@ -0,0 +1,265 @@
+package mistclient
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the request latency histogram buckets.
+var DefaultLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// prometheusNamespace prefixes the names of the exposed metrics.
+const prometheusNamespace = "mistclient"
+
+// PrometheusMetrics is a Metrics implementation that exposes the client's measurements in the Prometheus
+// text exposition format, without depending on the Prometheus client library. It implements http.Handler,
+// so it can be mounted directly on a metrics endpoint, or its output appended to an existing one with WriteTo.
+type PrometheusMetrics struct {
+	mu      sync.Mutex
+	buckets []float64
+
+	requests      map[requestSeries]*histogram
+	bytes         map[string]float64
+	retries       map[string]float64
+	rateLimited   map[string]float64
+	connections   float64
+	subscriptions float64
+	dropped       map[string]float64
+	decodeErrors  map[string]float64
+	reconnects    map[string]float64
+}
+
+// requestSeries identifies a request latency histogram by its labels.
+type requestSeries struct {
+	endpoint string
+	method   string
+	status   string
+}
+
+// histogram holds cumulative bucket counts, along with the sum and count of observations.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewPrometheusMetrics returns an empty PrometheusMetrics. Request latencies are recorded in buckets with the
+// given upper bounds in seconds, or DefaultLatencyBuckets if none are given.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+
+	return &PrometheusMetrics{
+		buckets:      buckets,
+		requests:     make(map[requestSeries]*histogram),
+		bytes:        make(map[string]float64),
+		retries:      make(map[string]float64),
+		rateLimited:  make(map[string]float64),
+		dropped:      make(map[string]float64),
+		decodeErrors: make(map[string]float64),
+		reconnects:   make(map[string]float64),
+	}
+}
+
+// ObserveRequest implements Metrics.
+func (m *PrometheusMetrics) ObserveRequest(endpoint, method string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series := requestSeries{endpoint: endpoint, method: method, status: strconv.Itoa(status)}
+	h, ok := m.requests[series]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.requests[series] = h
+	}
+
+	seconds := duration.Seconds()
+	for i, le := range m.buckets {
+		if seconds <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// AddBytesReceived implements Metrics.
+func (m *PrometheusMetrics) AddBytesReceived(endpoint string, n int) {
+	if n <= 0 {
+		return
+	}
+	m.add(m.bytes, endpoint, float64(n))
+}
+
+// IncRetries implements Metrics.
+func (m *PrometheusMetrics) IncRetries(endpoint string) {
+	m.add(m.retries, endpoint, 1)
+}
+
+// IncRateLimited implements Metrics.
+func (m *PrometheusMetrics) IncRateLimited(endpoint string) {
+	m.add(m.rateLimited, endpoint, 1)
+}
+
+// AddWebsocketConnections implements Metrics.
+func (m *PrometheusMetrics) AddWebsocketConnections(delta int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.connections += float64(delta)
+}
+
+// AddSubscriptions implements Metrics.
+func (m *PrometheusMetrics) AddSubscriptions(delta int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.subscriptions += float64(delta)
+}
+
+// IncMessagesDropped implements Metrics.
+func (m *PrometheusMetrics) IncMessagesDropped(channel string) {
+	m.add(m.dropped, channel, 1)
+}
+
+// IncDecodeErrors implements Metrics.
+func (m *PrometheusMetrics) IncDecodeErrors(channel string) {
+	m.add(m.decodeErrors, channel, 1)
+}
+
+// IncReconnects implements Metrics.
+func (m *PrometheusMetrics) IncReconnects(channel string) {
+	m.add(m.reconnects, channel, 1)
+}
+
+// add increments a labelled counter.
+func (m *PrometheusMetrics) add(counter map[string]float64, label string, v float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counter[label] += v
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text exposition format.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+
+	m.writeRequests(cw)
+	writeCounter(cw, "response_bytes_total", "Total size of REST response bodies received, in bytes.", "endpoint", m.bytes)
+	writeCounter(cw, "retries_total", "Total number of retried REST request attempts.", "endpoint", m.retries)
+	writeCounter(cw, "rate_limited_total", "Total number of REST responses with status 429 Too Many Requests.", "endpoint", m.rateLimited)
+	writeGauge(cw, "websocket_connections", "Number of open websocket connections.", m.connections)
+	writeGauge(cw, "subscriptions", "Number of active websocket subscriptions.", m.subscriptions)
+	writeCounter(cw, "messages_dropped_total", "Total number of websocket messages discarded before delivery.", "channel", m.dropped)
+	writeCounter(cw, "message_decode_errors_total", "Total number of websocket messages that could not be decoded.", "channel", m.decodeErrors)
+	writeCounter(cw, "websocket_reconnects_total", "Total number of websocket subscriptions re-established after losing their connection.", "channel", m.reconnects)
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// writeRequests writes the request counter and latency histogram.
+func (m *PrometheusMetrics) writeRequests(w *countingWriter) {
+	series := make([]requestSeries, 0, len(m.requests))
+	for s := range m.requests {
+		series = append(series, s)
+	}
+	slices.SortFunc(series, func(a, b requestSeries) int {
+		return strings.Compare(a.endpoint+"\x00"+a.method+"\x00"+a.status, b.endpoint+"\x00"+b.method+"\x00"+b.status)
+	})
+
+	labels := func(s requestSeries) string {
+		return fmt.Sprintf(`endpoint="%s",method="%s",status="%s"`, escapeLabel(s.endpoint), escapeLabel(s.method), s.status)
+	}
+
+	writeHeader(w, "requests_total", "Total number of REST request attempts, by endpoint, method and status (0 if no response was received).", "counter")
+	for _, s := range series {
+		w.printf("%s_requests_total{%s} %d\n", prometheusNamespace, labels(s), m.requests[s].count)
+	}
+
+	writeHeader(w, "request_duration_seconds", "Latency of REST request attempts, by endpoint, method and status.", "histogram")
+	for _, s := range series {
+		h := m.requests[s]
+		for i, le := range m.buckets {
+			w.printf("%s_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", prometheusNamespace, labels(s), formatFloat(le), h.counts[i])
+		}
+		w.printf("%s_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", prometheusNamespace, labels(s), h.count)
+		w.printf("%s_request_duration_seconds_sum{%s} %s\n", prometheusNamespace, labels(s), formatFloat(h.sum))
+		w.printf("%s_request_duration_seconds_count{%s} %d\n", prometheusNamespace, labels(s), h.count)
+	}
+}
+
+// writeCounter writes a counter with a single label, in label order.
+func writeCounter(w *countingWriter, name, help, label string, values map[string]float64) {
+	writeHeader(w, name, help, "counter")
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		w.printf("%s_%s{%s=\"%s\"} %s\n", prometheusNamespace, name, label, escapeLabel(k), formatFloat(values[k]))
+	}
+}
+
+// writeGauge writes an unlabelled gauge.
+func writeGauge(w *countingWriter, name, help string, value float64) {
+	writeHeader(w, name, help, "gauge")
+	w.printf("%s_%s %s\n", prometheusNamespace, name, formatFloat(value))
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric.
+func writeHeader(w *countingWriter, name, help, typ string) {
+	w.printf("# HELP %s_%s %s\n", prometheusNamespace, name, help)
+	w.printf("# TYPE %s_%s %s\n", prometheusNamespace, name, typ)
+}
+
+// escapeLabel escapes a label value for the text exposition format.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// formatFloat formats a sample value for the text exposition format.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter writes formatted output, counting the bytes written and retaining the first error.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+// printf writes formatted output unless an earlier write has failed.
+func (cw *countingWriter) printf(format string, args ...any) {
+	if cw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(cw.w, format, args...)
+	cw.n += int64(n)
+	cw.err = err
+}
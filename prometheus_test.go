@@ -0,0 +1,44 @@
+package mistclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusMetricsExposition(t *testing.T) {
+	m := NewPrometheusMetrics(1, 0.1)
+	m.ObserveRequest(EndpointOrgSites, "GET", 200, 50*time.Millisecond)
+	m.ObserveRequest(EndpointOrgSites, "GET", 200, 500*time.Millisecond)
+	m.ObserveRequest(EndpointOrgSites, "GET", 200, 2*time.Second)
+	m.IncMessagesDropped(`/sites/"quoted"`)
+	m.AddSubscriptions(2)
+	m.AddSubscriptions(-1)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("PrometheusMetrics.ServeHTTP(): unexpected content type: %q", ct)
+	}
+
+	out := rec.Body.String()
+	series := `endpoint="/api/v1/orgs/:org_id/sites",method="GET",status="200"`
+	for _, want := range []string{
+		"# TYPE mistclient_request_duration_seconds histogram",
+		`mistclient_request_duration_seconds_bucket{` + series + `,le="0.1"} 1`,
+		`mistclient_request_duration_seconds_bucket{` + series + `,le="1"} 2`,
+		`mistclient_request_duration_seconds_bucket{` + series + `,le="+Inf"} 3`,
+		`mistclient_request_duration_seconds_sum{` + series + `} 2.55`,
+		`mistclient_requests_total{` + series + `} 3`,
+		`mistclient_messages_dropped_total{channel="/sites/\"quoted\""} 1`,
+		"# TYPE mistclient_subscriptions gauge",
+		"mistclient_subscriptions 1",
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("PrometheusMetrics.ServeHTTP(): expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package mistclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultRetryAfter is the back-off applied after a 429 response that carries no usable Retry-After header.
+const defaultRetryAfter = time.Minute
+
+// quotaWindow is the period over which Mist enforces its per-token request quota.
+const quotaWindow = time.Hour
+
+// RateLimitConfig configures the client-side request scheduler.
+//
+// Mist enforces an hourly request quota per API token (5000 requests by default). When RequestsPerHour
+// is set, requests are spaced evenly across the hour, allowing short bursts of up to Burst requests
+// (default 1), and are held back once the hourly budget has been spent.
+//
+// Regardless of this setting, the client always honours the Retry-After header of a 429 response by
+// pausing all requests until it has elapsed. As with the request itself, a call is held back for no longer
+// than its context's deadline or, without one, Config.Timeout; should the pause outlast that, the call
+// fails straight away with an error wrapping ErrRateLimited.
+type RateLimitConfig struct {
+	RequestsPerHour int `yaml:"requests_per_hour,omitempty"`
+	Burst           int `yaml:"burst,omitempty"`
+}
+
+// RateLimitStatus is a snapshot of the client-side request budget.
+type RateLimitStatus struct {
+	// Limit is the configured number of requests per hour, or zero if requests are not being scheduled.
+	Limit int
+	// Remaining is the number of requests left in the current hourly window, or -1 if Limit is zero.
+	Remaining int
+	// Reset is the time at which the current hourly window ends.
+	Reset time.Time
+	// BlockedUntil is the time until which requests are paused following a 429 response.
+	BlockedUntil time.Time
+}
+
+// rateLimiter is a token bucket that smooths requests across an hourly quota window.
+type rateLimiter struct {
+	mu sync.Mutex
+
+	limit    int
+	burst    int
+	interval time.Duration
+
+	tokens       float64
+	last         time.Time
+	windowStart  time.Time
+	used         int
+	blockedUntil time.Time
+
+	now func() time.Time
+}
+
+// newRateLimiter returns a rateLimiter for the given configuration.
+func newRateLimiter(config RateLimitConfig) *rateLimiter {
+	l := &rateLimiter{
+		limit: config.RequestsPerHour,
+		burst: config.Burst,
+		now:   time.Now,
+	}
+	if l.limit > 0 {
+		l.interval = quotaWindow / time.Duration(l.limit)
+		if l.burst <= 0 {
+			l.burst = 1
+		}
+		l.tokens = float64(l.burst)
+	}
+	return l
+}
+
+// wait blocks until a request may be made within the configured budget, or the context is done. Should the
+// wait extend beyond the context's deadline, it fails straight away.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	for {
+		delay := l.reserve()
+		if delay <= 0 {
+			return nil
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return fmt.Errorf("%w: requests held back for %s, beyond the deadline: %w", ErrRateLimited, delay.Round(time.Millisecond), context.DeadlineExceeded)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve consumes a token and returns zero if a request may be made now. Otherwise it returns the
+// time to wait before trying again.
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Before(l.blockedUntil) {
+		return l.blockedUntil.Sub(now)
+	}
+	if l.limit <= 0 {
+		return 0
+	}
+
+	if l.windowStart.IsZero() || now.Sub(l.windowStart) >= quotaWindow {
+		l.windowStart = now
+		l.used = 0
+	}
+	if l.used >= l.limit {
+		return l.windowStart.Add(quotaWindow).Sub(now)
+	}
+
+	if !l.last.IsZero() {
+		l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return time.Duration((1 - l.tokens) * float64(l.interval))
+	}
+
+	l.tokens--
+	l.used++
+	return 0
+}
+
+// block pauses all requests until the given time.
+func (l *rateLimiter) block(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+}
+
+// status returns a snapshot of the current request budget.
+func (l *rateLimiter) status() RateLimitStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := RateLimitStatus{
+		Limit:        l.limit,
+		Remaining:    -1,
+		BlockedUntil: l.blockedUntil,
+	}
+	if l.limit <= 0 {
+		return s
+	}
+
+	now := l.now()
+	if l.windowStart.IsZero() || now.Sub(l.windowStart) >= quotaWindow {
+		s.Remaining = l.limit
+		s.Reset = now.Add(quotaWindow)
+		return s
+	}
+	s.Remaining = l.limit - l.used
+	s.Reset = l.windowStart.Add(quotaWindow)
+	return s
+}
+
+// retryAfter parses the Retry-After header of a response, which may be either a number of seconds
+// or an HTTP date, and returns the time at which requests may resume.
+func retryAfter(h http.Header, now time.Time) time.Time {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return now.Add(defaultRetryAfter)
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return now.Add(time.Duration(seconds) * time.Second)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t
+	}
+	return now.Add(defaultRetryAfter)
+}
+
+// RateLimit returns a snapshot of the client-side request budget, allowing callers to degrade
+// gracefully, for example by skipping low-priority requests, as the hourly quota is approached.
+func (c *APIClient) RateLimit() RateLimitStatus {
+	return c.limiter.status()
+}
@@ -0,0 +1,169 @@
+package mistclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBudget(t *testing.T) {
+	now := time.Date(2025, 8, 7, 12, 0, 0, 0, time.UTC)
+	l := newRateLimiter(RateLimitConfig{RequestsPerHour: 3600, Burst: 2})
+	l.now = func() time.Time { return now }
+
+	if d := l.reserve(); d != 0 {
+		t.Fatalf("reserve(): expected first burst request to proceed, got delay: %s", d)
+	}
+	if d := l.reserve(); d != 0 {
+		t.Fatalf("reserve(): expected second burst request to proceed, got delay: %s", d)
+	}
+	if d := l.reserve(); d != time.Second {
+		t.Fatalf("reserve(): expected 1s delay once burst is spent, got: %s", d)
+	}
+
+	now = now.Add(time.Second)
+	if d := l.reserve(); d != 0 {
+		t.Fatalf("reserve(): expected request to proceed after refill, got delay: %s", d)
+	}
+
+	s := l.status()
+	if s.Limit != 3600 || s.Remaining != 3597 {
+		t.Errorf("status(): expected limit 3600 and 3597 remaining, got: %d and %d", s.Limit, s.Remaining)
+	}
+	if want := now.Add(-time.Second).Add(time.Hour); !s.Reset.Equal(want) {
+		t.Errorf("status(): expected reset at %s, got: %s", want, s.Reset)
+	}
+}
+
+func TestRateLimiterWindowExhausted(t *testing.T) {
+	now := time.Date(2025, 8, 7, 12, 0, 0, 0, time.UTC)
+	l := newRateLimiter(RateLimitConfig{RequestsPerHour: 2, Burst: 2})
+	l.now = func() time.Time { return now }
+
+	l.reserve()
+	l.reserve()
+	if d := l.reserve(); d != time.Hour {
+		t.Fatalf("reserve(): expected to wait for window reset, got: %s", d)
+	}
+	if s := l.status(); s.Remaining != 0 {
+		t.Errorf("status(): expected 0 remaining, got: %d", s.Remaining)
+	}
+
+	now = now.Add(time.Hour)
+	if d := l.reserve(); d != 0 {
+		t.Errorf("reserve(): expected request to proceed in new window, got delay: %s", d)
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	l := newRateLimiter(RateLimitConfig{})
+	for range 100 {
+		if d := l.reserve(); d != 0 {
+			t.Fatalf("reserve(): expected no delay when unlimited, got: %s", d)
+		}
+	}
+	if s := l.status(); s.Limit != 0 || s.Remaining != -1 {
+		t.Errorf("status(): expected limit 0 and remaining -1, got: %d and %d", s.Limit, s.Remaining)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 8, 7, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value string
+		want  time.Time
+	}{
+		{name: "Seconds", value: "30", want: now.Add(30 * time.Second)},
+		{name: "HTTP date", value: "Thu, 07 Aug 2025 12:05:00 GMT", want: now.Add(5 * time.Minute)},
+		{name: "Missing", value: "", want: now.Add(defaultRetryAfter)},
+		{name: "Invalid", value: "soon", want: now.Add(defaultRetryAfter)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if tt.value != "" {
+				h.Set("Retry-After", tt.value)
+			}
+			if got := retryAfter(h, now); !got.Equal(tt.want) {
+				t.Errorf("retryAfter(%q): expected %s, got: %s", tt.value, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRateLimitRetryAfterBlocksRequests(t *testing.T) {
+	var requests atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	if _, err := c.GetSelf(); err == nil {
+		t.Fatal("APIClient.GetSelf(): expected error on 429 response, got nil")
+	}
+	if blocked := c.RateLimit().BlockedUntil; time.Until(blocked) < 59*time.Minute {
+		t.Errorf("APIClient.RateLimit().BlockedUntil: expected ~1h from now, got: %s", blocked)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetSelfContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("APIClient.GetSelfContext(): expected request to be held back until deadline, got: %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected 1 request to reach the server, got: %d", n)
+	}
+}
+
+func TestRateLimitRetryAfterBoundedByTimeout(t *testing.T) {
+	var requests atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey", Timeout: 500 * time.Millisecond, Retry: NoRetry}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	if _, err := c.GetSelf(); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("APIClient.GetSelf(): expected ErrRateLimited on 429 response, got: %v", err)
+	}
+
+	// A call without a context is held back no longer than the client's timeout.
+	start := time.Now()
+	if _, err := c.GetSelf(); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("APIClient.GetSelf(): expected ErrRateLimited while paused, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("APIClient.GetSelf(): expected the pause to be bounded by the timeout, took %s", elapsed)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected 1 request to reach the server, got: %d", n)
+	}
+}
+
+func TestRateLimitBurstScaledByPool(t *testing.T) {
+	c, err := New(&Config{BaseURL: "https://api.mist.com", APIKeys: []string{"a", "b", "c"}, RateLimit: RateLimitConfig{RequestsPerHour: 5000}}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	if c.limiter.burst != 3 || c.limiter.limit != 15000 {
+		t.Errorf("New(): expected a burst of 3 and limit of 15000 for 3 tokens, got: %d and %d", c.limiter.burst, c.limiter.limit)
+	}
+}
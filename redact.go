@@ -0,0 +1,298 @@
+package mistclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// redactedValue replaces redacted header values.
+const redactedValue = "[REDACTED]"
+
+// MACRedaction selects how MAC addresses are redacted from log output.
+type MACRedaction int
+
+const (
+	// MACKeep logs MAC addresses unchanged.
+	MACKeep MACRedaction = iota
+	// MACHash replaces MAC addresses with a short hash, so that log lines about the same device can still be correlated.
+	MACHash
+	// MACTruncate keeps only the vendor prefix (OUI) of MAC addresses.
+	MACTruncate
+)
+
+// RedactionPolicy configures the redaction of secrets and personal data from the client's log output,
+// including request and response bodies and websocket messages logged at TRACE level.
+//
+// The zero value redacts nothing. DefaultRedactionPolicy is applied unless another is set with WithRedaction.
+type RedactionPolicy struct {
+	// Headers lists HTTP headers whose values are masked, matched ignoring case.
+	Headers []string
+	// MACs selects how MAC addresses are redacted wherever they appear.
+	MACs MACRedaction
+	// Fields lists paths of fields stripped from logged JSON bodies, matched ignoring case. A path is a
+	// dot-separated sequence of field names, such as "guest.email", which matches wherever it appears in the
+	// document, including within arrays; a single name such as "username" matches a field at any depth.
+	Fields []string
+}
+
+// DefaultRedactionPolicy masks authentication headers, hashes MAC addresses and strips credentials, API
+// token keys and client identifiers from logged bodies.
+var DefaultRedactionPolicy = RedactionPolicy{
+	Headers: []string{"Authorization", "Cookie", "Set-Cookie", headerCSRFToken},
+	MACs:    MACHash,
+	Fields:  []string{"password", "two_factor", "key", "username", "hostname", "guest.email", "guest.name"},
+}
+
+// NoRedaction is a redaction policy that logs everything unchanged.
+var NoRedaction = RedactionPolicy{}
+
+// WithRedaction sets the policy used to redact the client's log output, overriding DefaultRedactionPolicy.
+func WithRedaction(policy RedactionPolicy) Option {
+	return func(o *options) {
+		o.redaction = &policy
+	}
+}
+
+// macPattern matches candidate MAC addresses, either colon or hyphen separated, or as a bare run of 12 hex
+// digits (Mist's own format). Candidates adjacent to further separators, such as the final group of a UUID,
+// are rejected by isMAC.
+var macPattern = regexp.MustCompile(`\b(?:[0-9A-Fa-f]{2}(?:[:-][0-9A-Fa-f]{2}){5}|[0-9A-Fa-f]{12})\b`)
+
+// macValuePattern matches a string consisting solely of a MAC address, as held by a MAC field.
+var macValuePattern = regexp.MustCompile(`^(?:[0-9A-Fa-f]{2}(?:[:-][0-9A-Fa-f]{2}){5}|[0-9A-Fa-f]{12})$`)
+
+// isMACField reports whether a field or attribute name, such as "mac" or "ap_mac", holds a MAC address.
+func isMACField(name string) bool {
+	name = strings.ToLower(name)
+	return name == "mac" || strings.HasSuffix(name, "_mac")
+}
+
+// redactor applies a redaction policy to log attributes.
+type redactor struct {
+	policy  RedactionPolicy
+	headers map[string]bool
+	fields  [][]string
+}
+
+// newRedactor returns a redactor for the given policy.
+func newRedactor(policy RedactionPolicy) *redactor {
+	r := &redactor{policy: policy, headers: make(map[string]bool)}
+	for _, h := range policy.Headers {
+		r.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	for _, f := range policy.Fields {
+		r.fields = append(r.fields, strings.Split(strings.ToLower(f), "."))
+	}
+	return r
+}
+
+// attr returns a copy of a log attribute with the policy applied.
+func (r *redactor) attr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		if isMACField(a.Key) {
+			return slog.String(a.Key, r.macField(v.String()))
+		}
+		return slog.String(a.Key, r.string(v.String()))
+	case slog.KindGroup:
+		attrs := v.Group()
+		redacted := make([]any, len(attrs))
+		for i, ga := range attrs {
+			redacted[i] = r.attr(ga)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		if h, ok := v.Any().(http.Header); ok {
+			return slog.Any(a.Key, r.header(h))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// header returns a copy of a header with the values of sensitive headers masked.
+func (r *redactor) header(h http.Header) http.Header {
+	masked := h.Clone()
+	for k, values := range masked {
+		if r.headers[http.CanonicalHeaderKey(k)] {
+			for i := range values {
+				values[i] = redactedValue
+			}
+		}
+	}
+	return masked
+}
+
+// string redacts a string. A JSON document has the policy's fields stripped and MAC addresses redacted
+// from its string values, leaving numbers and keys untouched; any other string has its MAC addresses redacted.
+func (r *redactor) string(s string) string {
+	if len(r.fields) > 0 || r.policy.MACs != MACKeep {
+		if trimmed := strings.TrimSpace(s); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+			if redacted, ok := r.json(s); ok {
+				return redacted
+			}
+		}
+	}
+	return r.macs(s)
+}
+
+// json redacts a JSON document, reporting false if it cannot be parsed.
+func (r *redactor) json(s string) (string, bool) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return s, false
+	}
+	doc = r.strip(doc, nil)
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return s, false
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), true
+}
+
+// strip removes matching fields from a decoded JSON value, given the path of field names leading to it,
+// and redacts MAC addresses from its string values. It returns the redacted value.
+func (r *redactor) strip(v any, path []string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			childPath := append(path[:len(path):len(path)], strings.ToLower(k))
+			if r.matches(childPath) {
+				delete(v, k)
+				continue
+			}
+			v[k] = r.strip(child, childPath)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = r.strip(child, path)
+		}
+	case string:
+		if len(path) > 0 && isMACField(path[len(path)-1]) {
+			return r.macField(v)
+		}
+		return r.macs(v)
+	}
+	return v
+}
+
+// matches reports whether a field path ends with any of the policy's field paths.
+func (r *redactor) matches(path []string) bool {
+	for _, f := range r.fields {
+		if len(f) <= len(path) && slices.Equal(path[len(path)-len(f):], f) {
+			return true
+		}
+	}
+	return false
+}
+
+// macs redacts the MAC addresses found in a string.
+func (r *redactor) macs(s string) string {
+	if r.policy.MACs == MACKeep {
+		return s
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range macPattern.FindAllStringIndex(s, -1) {
+		if !isMAC(s, m[0], m[1]) {
+			continue
+		}
+		b.WriteString(s[last:m[0]])
+		b.WriteString(r.mac(s[m[0]:m[1]]))
+		last = m[1]
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// macField redacts the value of a MAC field. A value consisting solely of a MAC address is redacted even if
+// it has no a-f digits, as the field name leaves no doubt that it is one.
+func (r *redactor) macField(s string) string {
+	if r.policy.MACs != MACKeep && macValuePattern.MatchString(s) {
+		return r.mac(s)
+	}
+	return r.macs(s)
+}
+
+// isMAC reports whether the candidate s[start:end] matched by macPattern is a MAC address. Candidates adjacent
+// to a further separator are part of a longer identifier, such as a UUID, and a bare run of digits must
+// include at least one of a-f to be told apart from a 12-digit number or ID.
+func isMAC(s string, start, end int) bool {
+	if (start > 0 && strings.IndexByte(":-", s[start-1]) >= 0) || (end < len(s) && strings.IndexByte(":-", s[end]) >= 0) {
+		return false
+	}
+	return end-start != 12 || strings.ContainsAny(strings.ToLower(s[start:end]), "abcdef")
+}
+
+// mac redacts a MAC address.
+func (r *redactor) mac(s string) string {
+	digits := strings.ToLower(strings.NewReplacer(":", "", "-", "").Replace(s))
+
+	switch r.policy.MACs {
+	case MACTruncate:
+		return digits[:6] + "xxxxxx"
+	default:
+		sum := sha256.Sum256([]byte(digits))
+		return "mac#" + hex.EncodeToString(sum[:4])
+	}
+}
+
+// redactingHandler is a slog.Handler that applies a redaction policy to every attribute before passing
+// records on to another handler.
+type redactingHandler struct {
+	handler  slog.Handler
+	redactor *redactor
+}
+
+// NewRedactingHandler returns a slog.Handler that applies a redaction policy to log records before passing
+// them to h. The client wraps its logger's handler with one, but it may also be used to redact other logs.
+func NewRedactingHandler(h slog.Handler, policy RedactionPolicy) slog.Handler {
+	return &redactingHandler{handler: h, redactor: newRedactor(policy)}
+}
+
+// Enabled implements slog.Handler.
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler.
+func (h *redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(h.redactor.attr(a))
+		return true
+	})
+	return h.handler.Handle(ctx, redacted)
+}
+
+// WithAttrs implements slog.Handler.
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.redactor.attr(a)
+	}
+	return &redactingHandler{handler: h.handler.WithAttrs(redacted), redactor: h.redactor}
+}
+
+// WithGroup implements slog.Handler.
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{handler: h.handler.WithGroup(name), redactor: h.redactor}
+}
@@ -0,0 +1,149 @@
+package mistclient
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedactString(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RedactionPolicy
+		in     string
+		want   string
+	}{
+		{
+			name:   "Strips fields at any depth",
+			policy: RedactionPolicy{Fields: []string{"username", "Guest.Email"}},
+			in:     `[{"username": "jsmith", "guest": {"email": "j@example.com", "company": "ACME"}, "email": "kept"}]`,
+			want:   `[{"email":"kept","guest":{"company":"ACME"}}]`,
+		},
+		{
+			name:   "Preserves numbers",
+			policy: RedactionPolicy{Fields: []string{"hostname"}},
+			in:     `{"hostname": "laptop", "last_seen": 1700000000123}`,
+			want:   `{"last_seen":1700000000123}`,
+		},
+		{
+			name:   "Leaves invalid JSON",
+			policy: RedactionPolicy{Fields: []string{"username"}},
+			in:     `{"username": `,
+			want:   `{"username": `,
+		},
+		{
+			name:   "Hashes MACs",
+			policy: RedactionPolicy{MACs: MACHash},
+			in:     "mac=5c5b35000001 other=5C:5B:35:00:00:01",
+			want:   "mac=" + newRedactor(RedactionPolicy{MACs: MACHash}).mac("5c5b35000001") + " other=" + newRedactor(RedactionPolicy{MACs: MACHash}).mac("5c5b35000001"),
+		},
+		{
+			name:   "Leaves UUIDs",
+			policy: RedactionPolicy{MACs: MACTruncate},
+			in:     "/api/v1/sites/x/devices/00000000-0000-0000-1000-5c5b35000001",
+			want:   "/api/v1/sites/x/devices/00000000-0000-0000-1000-5c5b35000001",
+		},
+		{
+			name:   "Truncates bare MACs",
+			policy: RedactionPolicy{MACs: MACTruncate},
+			in:     `{"mac":"5c5b35000001"}`,
+			want:   `{"mac":"5c5b35xxxxxx"}`,
+		},
+		{
+			name:   "Preserves 12-digit numbers and IDs",
+			policy: RedactionPolicy{MACs: MACTruncate},
+			in:     `{"last_seen":170000000012,"order_id":"123456789012","note":"ticket 123456789012"}`,
+			want:   `{"last_seen":170000000012,"note":"ticket 123456789012","order_id":"123456789012"}`,
+		},
+		{
+			name:   "Truncates MAC fields without a-f digits",
+			policy: RedactionPolicy{MACs: MACTruncate},
+			in:     `{"ap_mac":"001122334455","uplink":{"mac":"00:11:22:33:44:55"}}`,
+			want:   `{"ap_mac":"001122xxxxxx","uplink":{"mac":"001122xxxxxx"}}`,
+		},
+		{
+			name:   "Leaves longer hex runs",
+			policy: RedactionPolicy{MACs: MACTruncate},
+			in:     "id=5c5b350000012 key=x5c5b35000001",
+			want:   "id=5c5b350000012 key=x5c5b35000001",
+		},
+		{
+			name:   "Zero policy",
+			policy: NoRedaction,
+			in:     `{"username": "jsmith", "mac": "5c5b35000001"}`,
+			want:   `{"username": "jsmith", "mac": "5c5b35000001"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newRedactor(tt.policy).string(tt.in); got != tt.want {
+				t.Errorf("redactor.string(): expected %q, got: %q", tt.want, got)
+			}
+		})
+	}
+
+	if got := newRedactor(RedactionPolicy{MACs: MACHash}).mac("5c5b35000001"); !strings.HasPrefix(got, "mac#") || strings.Contains(got, "5c5b35") {
+		t.Errorf("redactor.mac(): expected an opaque hash, got: %q", got)
+	}
+
+	r := newRedactor(RedactionPolicy{MACs: MACTruncate})
+	if got := r.attr(slog.String("mac", "001122334455")).Value.String(); got != "001122xxxxxx" {
+		t.Errorf("redactor.attr(): expected the mac attribute to be truncated, got: %q", got)
+	}
+	if got := r.attr(slog.String("count", "001122334455")).Value.String(); got != "001122334455" {
+		t.Errorf("redactor.attr(): expected a 12-digit number to be kept, got: %q", got)
+	}
+}
+
+func TestRedactTraceLogs(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"mac": "5c5b35000001", "username": "jsmith", "hostname": "jsmith-laptop", "guest": {"email": "j@example.com", "name": "John"}, "ssid": "corp"}]`))
+	}))
+	defer s.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, NewTraceHandlerOptions()))
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "secretAPIKey"}, logger)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+	if _, err := c.GetSiteClientStats("test-site-id"); err != nil {
+		t.Fatalf("APIClient.GetSiteClientStats(): unexpected error: %v", err)
+	}
+
+	out := buf.String()
+	for _, leaked := range []string{"secretAPIKey", "5c5b35000001", "jsmith", "j@example.com", "John"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("TRACE logs: expected %q to be redacted, got:\n%s", leaked, out)
+		}
+	}
+	for _, kept := range []string{redactedValue, "corp", "api response body"} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("TRACE logs: expected output to contain %q, got:\n%s", kept, out)
+		}
+	}
+}
+
+func TestRedactDisabled(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, NewTraceHandlerOptions()))
+
+	s := testAPIServer(t)
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, logger, WithRedaction(NoRedaction))
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+	if _, err := c.GetSelf(); err != nil {
+		t.Fatalf("APIClient.GetSelf(): unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "testAPIKey") {
+		t.Errorf("TRACE logs: expected the token to be logged without redaction")
+	}
+}
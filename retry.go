@@ -0,0 +1,150 @@
+package mistclient
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Default back-off bounds applied when a RetryPolicy leaves them unset.
+const (
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// RetryPolicy configures how failed idempotent requests (GET, HEAD, OPTIONS, PUT and DELETE) are retried.
+//
+// Requests are retried on network errors, 5xx responses and 429 responses. Between attempts the client
+// sleeps for a random duration of up to InitialBackoff * 2^(attempt-1), capped at MaxBackoff ("full jitter").
+// Following a 429 response the next attempt is additionally held back until the Retry-After header has
+// elapsed; if that is longer than MaxBackoff, the 429 response is returned without retrying.
+//
+// The zero value disables retries.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first. Values below 2 disable retries.
+	MaxAttempts    int           `yaml:"max_attempts,omitempty"`
+	InitialBackoff time.Duration `yaml:"initial_backoff,omitempty"`
+	MaxBackoff     time.Duration `yaml:"max_backoff,omitempty"`
+}
+
+// DefaultRetryPolicy is a reasonable retry policy for most workloads.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: defaultInitialBackoff,
+	MaxBackoff:     defaultMaxBackoff,
+}
+
+// NoRetry is a retry policy that disables retries.
+var NoRetry = RetryPolicy{}
+
+// initialBackoff returns the policy's initial back-off, or the default if unset.
+func (p RetryPolicy) initialBackoff() time.Duration {
+	if p.InitialBackoff <= 0 {
+		return defaultInitialBackoff
+	}
+	return p.InitialBackoff
+}
+
+// maxBackoff returns the policy's maximum back-off, or the default if unset.
+func (p RetryPolicy) maxBackoff() time.Duration {
+	if p.MaxBackoff <= 0 {
+		return defaultMaxBackoff
+	}
+	return p.MaxBackoff
+}
+
+// backoff returns a jittered delay to wait after the given (1-based) attempt has failed.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.maxBackoff()
+	d := p.initialBackoff()
+	for i := 1; i < attempt && d < ceiling; i++ {
+		d *= 2
+	}
+	if d > ceiling {
+		d = ceiling
+	}
+	return time.Duration(rand.Int64N(int64(d) + 1))
+}
+
+// retryPolicyKey is the context key under which a per-call retry policy override is stored.
+type retryPolicyKey struct{}
+
+// ContextWithRetryPolicy returns a copy of ctx that overrides the client's retry policy for any
+// request made with it. Pass NoRetry to disable retries for a single call.
+func ContextWithRetryPolicy(ctx context.Context, policy RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, policy)
+}
+
+// retryPolicyFor returns the retry policy in effect for a request made with the given context.
+func (c *APIClient) retryPolicyFor(ctx context.Context) RetryPolicy {
+	if policy, ok := ctx.Value(retryPolicyKey{}).(RetryPolicy); ok {
+		return policy
+	}
+	return c.retry
+}
+
+// isIdempotent reports whether requests with the given method may safely be retried.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// shouldRetry reports whether the outcome of a request attempt warrants a retry.
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// sendWithRetry sends a request with any additional headers, retrying idempotent requests according to the retry policy in effect for the context.
+func (c *APIClient) sendWithRetry(ctx context.Context, method string, u *url.URL, data []byte, header http.Header) (*http.Response, error) {
+	policy := c.retryPolicyFor(ctx)
+	attempts := 1
+	if isIdempotent(method) && policy.MaxAttempts > 1 {
+		attempts = policy.MaxAttempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, method, u, data, header, attempt)
+		if attempt >= attempts || !shouldRetry(ctx, resp, err) {
+			return resp, err
+		}
+
+		delay := policy.backoff(attempt)
+		if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+			// The next attempt is held back until Retry-After has elapsed, either by the rate limiter or,
+			// with several tokens, until a token is available. Only retry if that falls within the
+			// policy's maximum back-off.
+			wait := max(time.Until(c.limiter.status().BlockedUntil), c.tokens.wait())
+			if wait > policy.maxBackoff() {
+				return resp, nil
+			}
+		}
+
+		reason := "network error"
+		if resp != nil {
+			reason = resp.Status
+			resp.Body.Close()
+		}
+		c.logger.Warn("retrying API request", "method", method, "url", u.String(), "attempt", attempt, "max_attempts", attempts, "reason", reason, "error", err, "backoff", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
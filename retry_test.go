@@ -0,0 +1,113 @@
+package mistclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testFlakyServer creates a test server that responds with the given failure status code to the
+// first failures requests, and with an empty JSON object thereafter.
+func testFlakyServer(t *testing.T, failures int32, status int, requests *atomic.Int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "0")
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("{}"))
+	}))
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+	tests := []struct {
+		name         string
+		failures     int32
+		status       int
+		method       string
+		ctx          context.Context
+		wantStatus   int
+		wantRequests int32
+	}{
+		{name: "Recovers from 503", failures: 2, status: http.StatusServiceUnavailable, method: http.MethodGet, wantStatus: http.StatusOK, wantRequests: 3},
+		{name: "Recovers from 429", failures: 1, status: http.StatusTooManyRequests, method: http.MethodGet, wantStatus: http.StatusOK, wantRequests: 2},
+		{name: "Gives up after max attempts", failures: 5, status: http.StatusBadGateway, method: http.MethodGet, wantStatus: http.StatusBadGateway, wantRequests: 3},
+		{name: "Does not retry 4xx", failures: 1, status: http.StatusNotFound, method: http.MethodGet, wantStatus: http.StatusNotFound, wantRequests: 1},
+		{name: "Does not retry POST", failures: 1, status: http.StatusServiceUnavailable, method: http.MethodPost, wantStatus: http.StatusServiceUnavailable, wantRequests: 1},
+		{name: "Retries PUT", failures: 1, status: http.StatusServiceUnavailable, method: http.MethodPut, wantStatus: http.StatusOK, wantRequests: 2},
+		{name: "Per-call override", failures: 1, status: http.StatusServiceUnavailable, method: http.MethodGet, ctx: ContextWithRetryPolicy(context.Background(), NoRetry), wantStatus: http.StatusServiceUnavailable, wantRequests: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			s := testFlakyServer(t, tt.failures, tt.status, &requests)
+			defer s.Close()
+
+			c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey", Retry: policy}, nil)
+			if err != nil {
+				t.Fatalf("New: unexpected error: %v", err)
+			}
+
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+
+			resp, err := c.doRequest(ctx, tt.method, c.baseURL.JoinPath("/api/v1/self"), nil)
+			if err != nil {
+				t.Fatalf("doRequest(): unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("doRequest(): expected status %d, got: %d", tt.wantStatus, resp.StatusCode)
+			}
+			if n := requests.Load(); n != tt.wantRequests {
+				t.Errorf("doRequest(): expected %d requests, got: %d", tt.wantRequests, n)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyNetworkError(t *testing.T) {
+	s := httptest.NewServer(http.NotFoundHandler())
+	baseURL := s.URL
+	s.Close()
+
+	c, err := New(&Config{BaseURL: baseURL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	ctx := ContextWithRetryPolicy(context.Background(), RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond})
+	if _, err := c.GetContext(ctx, c.baseURL.JoinPath("/api/v1/self")); err == nil {
+		t.Error("APIClient.GetContext(): expected network error, got nil")
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, ceiling := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		3:  400 * time.Millisecond,
+		10: time.Second,
+	} {
+		for range 100 {
+			if d := p.backoff(attempt); d < 0 || d > ceiling {
+				t.Fatalf("RetryPolicy.backoff(%d): expected delay within [0, %s], got: %s", attempt, ceiling, d)
+			}
+		}
+	}
+}
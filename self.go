@@ -1,15 +1,22 @@
 package mistclient
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 )
 
 // GetSelf returns a ‘whoami’ and privileges of the account making the request
 func (c *APIClient) GetSelf() (Self, error) {
+	return c.GetSelfContext(context.Background())
+}
+
+// GetSelfContext is like GetSelf but bound to the supplied context.
+func (c *APIClient) GetSelfContext(ctx context.Context) (Self, error) {
 	var self Self
 
-	resp, err := c.Get(c.baseURL.JoinPath("/api/v1/self"))
+	resp, err := c.GetContext(ctx, c.baseURL.JoinPath("/api/v1/self"))
 	if err != nil {
 		return self, err
 	}
@@ -23,3 +30,71 @@ func (c *APIClient) GetSelf() (Self, error) {
 
 	return self, err
 }
+
+// ListSelfAPITokens returns the API tokens issued to the account making the request. Token keys are masked.
+func (c *APIClient) ListSelfAPITokens() ([]SelfAPIToken, error) {
+	return c.ListSelfAPITokensContext(context.Background())
+}
+
+// ListSelfAPITokensContext is like ListSelfAPITokens but bound to the supplied context.
+func (c *APIClient) ListSelfAPITokensContext(ctx context.Context) ([]SelfAPIToken, error) {
+	resp, err := c.GetContext(ctx, c.baseURL.JoinPath("/api/v1/self/apitokens"))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, extractError(resp)
+	}
+
+	var tokens []SelfAPIToken
+	err = json.NewDecoder(resp.Body).Decode(&tokens)
+
+	return tokens, err
+}
+
+// CreateSelfAPIToken issues a new API token to the account making the request, carrying the account's
+// privileges. The returned token holds the full key, which cannot be retrieved later.
+func (c *APIClient) CreateSelfAPIToken(name string) (SelfAPIToken, error) {
+	return c.CreateSelfAPITokenContext(context.Background(), name)
+}
+
+// CreateSelfAPITokenContext is like CreateSelfAPIToken but bound to the supplied context.
+func (c *APIClient) CreateSelfAPITokenContext(ctx context.Context, name string) (SelfAPIToken, error) {
+	var created SelfAPIToken
+
+	resp, err := c.PostContext(ctx, c.baseURL.JoinPath("/api/v1/self/apitokens"), SelfAPIToken{Name: name})
+	if err != nil {
+		return created, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return created, extractError(resp)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&created)
+
+	return created, err
+}
+
+// DeleteSelfAPIToken revokes an API token issued to the account making the request.
+func (c *APIClient) DeleteSelfAPIToken(tokenID string) error {
+	return c.DeleteSelfAPITokenContext(context.Background(), tokenID)
+}
+
+// DeleteSelfAPITokenContext is like DeleteSelfAPIToken but bound to the supplied context.
+func (c *APIClient) DeleteSelfAPITokenContext(ctx context.Context, tokenID string) error {
+	resp, err := c.DeleteContext(ctx, c.baseURL.JoinPath(fmt.Sprintf("/api/v1/self/apitokens/%s", tokenID)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return extractError(resp)
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package mistclient
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -46,3 +47,36 @@ func TestGetSelf(t *testing.T) {
 		t.Errorf("APIClient.GetSelf(): expected mspID '9520c63a-f7b3-670c-0944-727774d5a722', got: %s", mspID)
 	}
 }
+
+func TestSelfAPITokens(t *testing.T) {
+	s := testAPITokenServer(t, "/api/v1/self/apitokens")
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	created, err := c.CreateSelfAPIToken("short-lived")
+	if err != nil {
+		t.Fatalf("APIClient.CreateSelfAPIToken(): unexpected error: %v", err)
+	}
+	if created.Name != "short-lived" || created.Key != "secret-key-0001" {
+		t.Errorf("APIClient.CreateSelfAPIToken(): expected name and full key, got: %+v", created)
+	}
+
+	tokens, err := c.ListSelfAPITokens()
+	if err != nil {
+		t.Fatalf("APIClient.ListSelfAPITokens(): unexpected error: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].ID != created.ID || tokens[0].Key != "****0001" {
+		t.Errorf("APIClient.ListSelfAPITokens(): expected one masked token, got: %+v", tokens)
+	}
+
+	if err := c.DeleteSelfAPIToken(created.ID); err != nil {
+		t.Fatalf("APIClient.DeleteSelfAPIToken(): unexpected error: %v", err)
+	}
+	if err := c.DeleteSelfAPIToken(created.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("APIClient.DeleteSelfAPIToken(): expected ErrNotFound for revoked token, got: %v", err)
+	}
+}
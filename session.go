@@ -0,0 +1,295 @@
+package mistclient
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Session authentication endpoints, headers and cookies.
+const (
+	loginPath          = "/api/v1/login"
+	loginTwoFactorPath = "/api/v1/login/two_factor"
+	logoutPath         = "/api/v1/logout"
+	headerCSRFToken    = "X-CSRFToken"
+	cookieCSRFToken    = "csrftoken"
+)
+
+// ErrTwoFactorRequired is returned by Login when the account requires a second factor and neither a
+// TOTP secret nor a one-time code was supplied.
+var ErrTwoFactorRequired = errors.New("two-factor authentication required")
+
+// Credentials holds the username and password of a Mist admin account, used for session authentication.
+//
+// If the account has two-factor authentication enabled, supply either the base32-encoded TOTPSecret, from
+// which one-time codes are generated as required, or a current TwoFactorCode.
+type Credentials struct {
+	Email         string
+	Password      string
+	TOTPSecret    string
+	TwoFactorCode string
+}
+
+// session tracks the state of session (cookie) authentication for an APIClient. The mutex serialises
+// logins, and guards the login state and credentials. The generation counts successful logins, so that a
+// request rejected with a session since replaced does not expire its replacement.
+type session struct {
+	enabled atomic.Bool
+
+	mu         sync.Mutex
+	loggedIn   bool
+	generation uint64
+	creds      Credentials
+}
+
+// sessionJar is the cookie jar used unless the HTTP client supplies its own. It retains cookies only in
+// session authentication mode, creating the underlying jar on first use.
+type sessionJar struct {
+	s *session
+
+	mu  sync.Mutex
+	jar *cookiejar.Jar
+}
+
+// SetCookies implements http.CookieJar, discarding the cookies unless session authentication is enabled.
+func (j *sessionJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	if !j.s.enabled.Load() {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.jar == nil {
+		// cookiejar.New only fails given invalid options.
+		j.jar, _ = cookiejar.New(nil)
+	}
+	j.jar.SetCookies(u, cookies)
+}
+
+// Cookies implements http.CookieJar.
+func (j *sessionJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.jar == nil {
+		return nil
+	}
+	return j.jar.Cookies(u)
+}
+
+// Login authenticates with the Mist API using an admin account's username and password, and switches the
+// client to session authentication. Subsequent requests, including websocket connections, are authenticated
+// with the session cookies, and mutating requests carry the session's CSRF token.
+//
+// The credentials are retained so that the client can log in again should the session expire.
+func (c *APIClient) Login(ctx context.Context, creds Credentials) error {
+	c.session.mu.Lock()
+	defer c.session.mu.Unlock()
+
+	c.session.enabled.Store(true)
+	c.session.creds = creds
+
+	return c.login(ctx)
+}
+
+// login performs the login exchange with the stored credentials. The session lock must be held.
+func (c *APIClient) login(ctx context.Context) error {
+	creds := c.session.creds
+	c.session.loggedIn = false
+
+	var result struct {
+		TwoFactorRequired bool `json:"two_factor_required"`
+		TwoFactorPassed   bool `json:"two_factor_passed"`
+	}
+	if err := c.sessionPost(ctx, loginPath, map[string]string{"email": creds.Email, "password": creds.Password}, &result); err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+
+	if result.TwoFactorRequired && !result.TwoFactorPassed {
+		code := creds.TwoFactorCode
+		if creds.TOTPSecret != "" {
+			var err error
+			if code, err = totp(creds.TOTPSecret, time.Now()); err != nil {
+				return fmt.Errorf("login failed: %w", err)
+			}
+		}
+		if code == "" {
+			return fmt.Errorf("login failed: %w", ErrTwoFactorRequired)
+		}
+		if err := c.sessionPost(ctx, loginTwoFactorPath, map[string]string{"two_factor": code}, nil); err != nil {
+			return fmt.Errorf("two-factor authentication failed: %w", err)
+		}
+	}
+
+	c.session.loggedIn = true
+	c.session.generation++
+	c.logger.Debug("successfully logged in", "email", creds.Email)
+
+	return nil
+}
+
+// Logout ends the current session. The client remains in session authentication mode, and will log in
+// again with the stored credentials on the next request.
+func (c *APIClient) Logout(ctx context.Context) error {
+	c.session.mu.Lock()
+	defer c.session.mu.Unlock()
+
+	if !c.session.enabled.Load() {
+		return fmt.Errorf("client is not using session authentication")
+	}
+
+	c.session.loggedIn = false
+	if err := c.sessionPost(ctx, logoutPath, nil, nil); err != nil {
+		return fmt.Errorf("logout failed: %w", err)
+	}
+	c.logger.Debug("successfully logged out")
+
+	return nil
+}
+
+// sessionPost sends a POST request as part of the login and logout exchanges, decoding any response into result.
+// It bypasses doRequest so that it does not itself trigger a login.
+func (c *APIClient) sessionPost(ctx context.Context, path string, body any, result any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.send(ctx, http.MethodPost, c.baseURL.JoinPath(path), data, nil, 1)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return extractError(resp)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// ensureSession logs in with the stored credentials if the client is in session authentication mode
+// but does not hold a session, for example because it has expired. It returns the generation of the
+// session in use.
+func (c *APIClient) ensureSession(ctx context.Context) (uint64, error) {
+	if !c.session.enabled.Load() {
+		return 0, nil
+	}
+
+	c.session.mu.Lock()
+	defer c.session.mu.Unlock()
+
+	if c.session.loggedIn {
+		return c.session.generation, nil
+	}
+	if err := c.login(ctx); err != nil {
+		return 0, err
+	}
+	return c.session.generation, nil
+}
+
+// expireSession marks the session of the given generation as expired, so that the next request logs in
+// again. A session already replaced by a concurrent login is left in place. It reports whether the client
+// is in session authentication mode.
+func (c *APIClient) expireSession(generation uint64) bool {
+	c.session.mu.Lock()
+	defer c.session.mu.Unlock()
+
+	if c.session.generation == generation {
+		c.session.loggedIn = false
+	}
+	return c.session.enabled.Load()
+}
+
+// setAuthHeaders authenticates an outgoing request, either with the given API token or, in session mode,
+// with the CSRF token required on mutating requests. Session cookies are added by the cookie jar.
+func (c *APIClient) setAuthHeaders(h http.Header, method string, token string) {
+	if !c.session.enabled.Load() {
+		h.Set("Authorization", fmt.Sprintf("Token %s", token))
+		return
+	}
+
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return
+	}
+	if token := c.csrfToken(); token != "" {
+		h.Set(headerCSRFToken, token)
+	}
+}
+
+// csrfToken returns the CSRF token of the current session. Mist suffixes the cookie name on some
+// regional clouds (e.g. "csrftoken.eu"), so any cookie with the expected prefix is accepted.
+func (c *APIClient) csrfToken() string {
+	if c.client.Jar == nil {
+		return ""
+	}
+	for _, cookie := range c.client.Jar.Cookies(c.baseURL) {
+		if cookie.Name == cookieCSRFToken || strings.HasPrefix(cookie.Name, cookieCSRFToken+".") {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// setWebsocketAuthHeaders authenticates a websocket handshake with the given API token or the session cookies.
+func (c *APIClient) setWebsocketAuthHeaders(h http.Header, token string) {
+	if !c.session.enabled.Load() {
+		h.Set("Authorization", fmt.Sprintf("Token %s", token))
+		return
+	}
+
+	if c.client.Jar == nil {
+		return
+	}
+	var cookies []string
+	for _, cookie := range c.client.Jar.Cookies(c.baseURL) {
+		cookies = append(cookies, cookie.Name+"="+cookie.Value)
+	}
+	if len(cookies) > 0 {
+		h.Set("Cookie", strings.Join(cookies, "; "))
+	}
+	if token := c.csrfToken(); token != "" {
+		h.Set(headerCSRFToken, token)
+	}
+}
+
+// totp generates an RFC 6238 time-based one-time password (SHA-1, 30 second step, 6 digits) from a
+// base32-encoded secret.
+func totp(secret string, t time.Time) (string, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/30))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%06d", code%1000000), nil
+}
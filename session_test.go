@@ -0,0 +1,294 @@
+package mistclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	testEmail      = "admin@example.com"
+	testPassword   = "hunter2"
+	testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	testSessionID  = "test-session-id"
+	testCSRFToken  = "test-csrf-token"
+)
+
+// testSessionServer creates a test server that mimics the Mist session login flow, optionally requiring
+// a TOTP second factor, and serves /api/v1/self and a mutating endpoint to authenticated sessions.
+func testSessionServer(t *testing.T, twoFactor bool, logins *atomic.Int32) *httptest.Server {
+	t.Helper()
+
+	var passedTwoFactor atomic.Bool
+	authenticated := func(r *http.Request) bool {
+		cookie, err := r.Cookie("sessionid")
+		return err == nil && cookie.Value == testSessionID && (!twoFactor || passedTwoFactor.Load())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/login", func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}{}
+		if err := jsonDecode(r, &body); err != nil || body.Email != testEmail || body.Password != testPassword {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"detail": "Invalid credentials"}`))
+			return
+		}
+		logins.Add(1)
+		passedTwoFactor.Store(false)
+		http.SetCookie(w, &http.Cookie{Name: "csrftoken", Value: testCSRFToken, Path: "/"})
+		http.SetCookie(w, &http.Cookie{Name: "sessionid", Value: testSessionID, Path: "/"})
+		if twoFactor {
+			w.Write([]byte(`{"two_factor_required": true, "two_factor_passed": false}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("POST /api/v1/login/two_factor", func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			TwoFactor string `json:"two_factor"`
+		}{}
+		want, _ := totp(testTOTPSecret, time.Now())
+		if err := jsonDecode(r, &body); err != nil || body.TwoFactor != want {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"detail": "Invalid two-factor code"}`))
+			return
+		}
+		passedTwoFactor.Store(true)
+		w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("POST /api/v1/logout", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "sessionid", Value: "", Path: "/", MaxAge: -1})
+		w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("GET /api/v1/self", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("testSessionServer: unexpected Authorization header in session mode")
+		}
+		if !authenticated(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"email": "` + testEmail + `"}`))
+	})
+	mux.HandleFunc("PUT /api/v1/self", func(w http.ResponseWriter, r *http.Request) {
+		if !authenticated(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get(headerCSRFToken) != testCSRFToken {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"detail": "CSRF Failed: CSRF token missing or incorrect."}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	})
+	mux.Handle("/api-ws/v1/stream", websocket.Handler(func(ws *websocket.Conn) {
+		if !authenticated(ws.Request()) || ws.Request().Header.Get(headerCSRFToken) != testCSRFToken {
+			return
+		}
+		var subReq SubscriptionRequest
+		if err := websocket.JSON.Receive(ws, &subReq); err != nil {
+			return
+		}
+		websocket.JSON.Send(ws, SubscriptionResponse{Event: "channel_subscribed", Channel: subReq.Subscribe})
+		websocket.JSON.Receive(ws, &UnsubscribeRequest{})
+	}))
+
+	return httptest.NewServer(mux)
+}
+
+func TestLogin(t *testing.T) {
+	var logins atomic.Int32
+	s := testSessionServer(t, false, &logins)
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, WebsocketURL: "ws" + strings.TrimPrefix(s.URL, "http")}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := c.Login(ctx, Credentials{Email: testEmail, Password: "wrong"}); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("APIClient.Login(): expected ErrUnauthorized with wrong password, got: %v", err)
+	}
+	if err := c.Login(ctx, Credentials{Email: testEmail, Password: testPassword}); err != nil {
+		t.Fatalf("APIClient.Login(): unexpected error: %v", err)
+	}
+
+	self, err := c.GetSelfContext(ctx)
+	if err != nil {
+		t.Fatalf("APIClient.GetSelfContext(): unexpected error: %v", err)
+	}
+	if self.Email != testEmail {
+		t.Errorf("APIClient.GetSelfContext(): expected email %s, got: %s", testEmail, self.Email)
+	}
+
+	resp, err := c.PutContext(ctx, c.baseURL.JoinPath("/api/v1/self"), map[string]string{"first_name": "Test"})
+	if err != nil {
+		t.Fatalf("APIClient.PutContext(): unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("APIClient.PutContext(): expected CSRF token to be accepted, got status: %d", resp.StatusCode)
+	}
+
+	subCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	if _, err := c.Subscribe(subCtx, "/sites/test-site-id/stats/devices"); err != nil {
+		t.Errorf("APIClient.Subscribe(): unexpected error with session authentication: %v", err)
+	}
+
+	if err := c.Logout(ctx); err != nil {
+		t.Fatalf("APIClient.Logout(): unexpected error: %v", err)
+	}
+
+	// The client logs in again with the stored credentials on the next request.
+	if _, err := c.GetSelfContext(ctx); err != nil {
+		t.Errorf("APIClient.GetSelfContext(): unexpected error after logout: %v", err)
+	}
+	if n := logins.Load(); n != 2 {
+		t.Errorf("expected 2 successful logins, got: %d", n)
+	}
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	var logins atomic.Int32
+	s := testSessionServer(t, true, &logins)
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := c.Login(ctx, Credentials{Email: testEmail, Password: testPassword}); !errors.Is(err, ErrTwoFactorRequired) {
+		t.Fatalf("APIClient.Login(): expected ErrTwoFactorRequired, got: %v", err)
+	}
+	if err := c.Login(ctx, Credentials{Email: testEmail, Password: testPassword, TOTPSecret: testTOTPSecret}); err != nil {
+		t.Fatalf("APIClient.Login(): unexpected error: %v", err)
+	}
+	if _, err := c.GetSelfContext(ctx); err != nil {
+		t.Errorf("APIClient.GetSelfContext(): unexpected error: %v", err)
+	}
+}
+
+func TestSessionFromConfig(t *testing.T) {
+	var logins atomic.Int32
+	s := testSessionServer(t, true, &logins)
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, Email: testEmail, Password: testPassword, TOTPSecret: testTOTPSecret}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	// The first request logs in lazily.
+	if _, err := c.GetSelf(); err != nil {
+		t.Fatalf("APIClient.GetSelf(): unexpected error: %v", err)
+	}
+	if n := logins.Load(); n != 1 {
+		t.Errorf("expected 1 login, got: %d", n)
+	}
+
+	// An expired session is re-established transparently.
+	c.client.Jar.SetCookies(c.baseURL, []*http.Cookie{{Name: "sessionid", Value: "expired", Path: "/"}})
+	if _, err := c.GetSelf(); err != nil {
+		t.Fatalf("APIClient.GetSelf(): unexpected error after session expiry: %v", err)
+	}
+	if n := logins.Load(); n != 2 {
+		t.Errorf("expected 2 logins, got: %d", n)
+	}
+}
+
+func TestSessionConcurrentExpiry(t *testing.T) {
+	var logins atomic.Int32
+	s := testSessionServer(t, false, &logins)
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, Email: testEmail, Password: testPassword}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	if _, err := c.GetSelf(); err != nil {
+		t.Fatalf("APIClient.GetSelf(): unexpected error: %v", err)
+	}
+
+	// Every request is rejected with the expired session, but only one logs in again.
+	c.client.Jar.SetCookies(c.baseURL, []*http.Cookie{{Name: "sessionid", Value: "expired", Path: "/"}})
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetSelf(); err != nil {
+				t.Errorf("APIClient.GetSelf(): unexpected error after session expiry: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := logins.Load(); n != 2 {
+		t.Errorf("expected 2 logins, got: %d", n)
+	}
+}
+
+func TestAPITokenIgnoresCookies(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("sessionid"); err == nil {
+			t.Errorf("unexpected session cookie in API token mode")
+		}
+		http.SetCookie(w, &http.Cookie{Name: "sessionid", Value: testSessionID, Path: "/"})
+		w.Write([]byte(`{}`))
+	}))
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	for range 2 {
+		if _, err := c.GetSelf(); err != nil {
+			t.Fatalf("APIClient.GetSelf(): unexpected error: %v", err)
+		}
+	}
+	if cookies := c.client.Jar.Cookies(c.baseURL); len(cookies) != 0 {
+		t.Errorf("expected no cookies to be retained in API token mode, got: %v", cookies)
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 Appendix B test vectors (SHA-1), truncated to 6 digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := totp(testTOTPSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("totp(): unexpected error: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("totp(%d): expected %s, got: %s", tt.unix, tt.want, got)
+		}
+	}
+
+	if _, err := totp("not base32!", time.Now()); err == nil {
+		t.Error("totp(): expected error for invalid secret, got nil")
+	}
+}
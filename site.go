@@ -4,14 +4,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"iter"
 	"net/http"
 )
 
 // GetSiteStats fetches a site's operational statistics
 func (c *APIClient) GetSiteStats(siteID string) (SiteStat, error) {
+	return c.GetSiteStatsContext(context.Background(), siteID)
+}
+
+// GetSiteStatsContext is like GetSiteStats but bound to the supplied context.
+func (c *APIClient) GetSiteStatsContext(ctx context.Context, siteID string) (SiteStat, error) {
 	var siteStat SiteStat
 
-	resp, err := c.Get(c.baseURL.JoinPath(fmt.Sprintf("/api/v1/sites/%s/stats", siteID)))
+	resp, err := c.GetContext(ctx, c.baseURL.JoinPath(fmt.Sprintf("/api/v1/sites/%s/stats", siteID)))
 	if err != nil {
 		return siteStat, err
 	}
@@ -28,76 +34,102 @@ func (c *APIClient) GetSiteStats(siteID string) (SiteStat, error) {
 
 // GetSiteDevices fetches and returns a list of all devices configured at a site
 func (c *APIClient) GetSiteDevices(siteID string) ([]Device, error) {
-	resp, err := c.Get(c.baseURL.JoinPath(fmt.Sprintf("/api/v1/sites/%s/devices", siteID)))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+	return c.GetSiteDevicesContext(context.Background(), siteID)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, extractError(resp)
-	}
+// GetSiteDevicesContext is like GetSiteDevices but bound to the supplied context.
+func (c *APIClient) GetSiteDevicesContext(ctx context.Context, siteID string) ([]Device, error) {
+	return c.SiteDevicesPaginator(siteID).Collect(ctx)
+}
 
-	var devices []Device
-	if err := json.NewDecoder(resp.Body).Decode(&devices); err != nil {
-		return nil, err
-	}
+// SiteDevicesPaginator returns a Paginator over the devices configured at a site.
+func (c *APIClient) SiteDevicesPaginator(siteID string) *Paginator[Device] {
+	return newPaginator(c, c.baseURL.JoinPath(fmt.Sprintf("/api/v1/sites/%s/devices", siteID)), decodeList[Device])
+}
 
-	return devices, nil
+// AllSiteDevices returns an iterator over the devices configured at a site, fetching pages lazily.
+func (c *APIClient) AllSiteDevices(ctx context.Context, siteID string) iter.Seq2[Device, error] {
+	return c.SiteDevicesPaginator(siteID).All(ctx)
 }
 
 // StreamSiteDevices opens a websocket connection and subscribes to the site devices stream
-func (c *APIClient) StreamSiteDevices(ctx context.Context, siteID string) (<-chan Device, error) {
-	return streamStats[Device](ctx, c, fmt.Sprintf("/sites/%s/devices", siteID))
+func (c *APIClient) StreamSiteDevices(ctx context.Context, siteID string, opts ...SubscribeOption) (<-chan Device, error) {
+	sub, err := c.SiteDevicesSubscription(ctx, siteID, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return sub.C, nil
+}
+
+// SiteDevicesSubscription is like StreamSiteDevices, but returns a handle on the subscription reporting why it ended.
+func (c *APIClient) SiteDevicesSubscription(ctx context.Context, siteID string, opts ...SubscribeOption) (*Subscription[Device], error) {
+	return subscribeAs[Device](ctx, c, fmt.Sprintf("/sites/%s/devices", siteID), opts...)
 }
 
 // GetSiteDeviceStats fetches and returns a list of all devices configured at a site, supplemented with operational statistics
 func (c *APIClient) GetSiteDeviceStats(siteID string) ([]DeviceStat, error) {
-	resp, err := c.Get(c.baseURL.JoinPath(fmt.Sprintf("/api/v1/sites/%s/stats/devices", siteID)))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+	return c.GetSiteDeviceStatsContext(context.Background(), siteID)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, extractError(resp)
-	}
+// GetSiteDeviceStatsContext is like GetSiteDeviceStats but bound to the supplied context.
+func (c *APIClient) GetSiteDeviceStatsContext(ctx context.Context, siteID string) ([]DeviceStat, error) {
+	return c.SiteDeviceStatsPaginator(siteID).Collect(ctx)
+}
 
-	var devices []DeviceStat
-	if err := json.NewDecoder(resp.Body).Decode(&devices); err != nil {
-		return nil, err
-	}
+// SiteDeviceStatsPaginator returns a Paginator over the devices configured at a site, supplemented with operational statistics.
+func (c *APIClient) SiteDeviceStatsPaginator(siteID string) *Paginator[DeviceStat] {
+	return newPaginator(c, c.baseURL.JoinPath(fmt.Sprintf("/api/v1/sites/%s/stats/devices", siteID)), decodeList[DeviceStat])
+}
 
-	return devices, nil
+// AllSiteDeviceStats returns an iterator over the devices configured at a site, supplemented with operational statistics, fetching pages lazily.
+func (c *APIClient) AllSiteDeviceStats(ctx context.Context, siteID string) iter.Seq2[DeviceStat, error] {
+	return c.SiteDeviceStatsPaginator(siteID).All(ctx)
 }
 
 // StreamSiteDeviceStats opens a websocket connection and subscribes to the device statistics stream
-func (c *APIClient) StreamSiteDeviceStats(ctx context.Context, siteID string) (<-chan StreamedDeviceStat, error) {
-	return streamStats[StreamedDeviceStat](ctx, c, fmt.Sprintf("/sites/%s/stats/devices", siteID))
+func (c *APIClient) StreamSiteDeviceStats(ctx context.Context, siteID string, opts ...SubscribeOption) (<-chan StreamedDeviceStat, error) {
+	sub, err := c.SiteDeviceStatsSubscription(ctx, siteID, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return sub.C, nil
+}
 
+// SiteDeviceStatsSubscription is like StreamSiteDeviceStats, but returns a handle on the subscription reporting why it ended.
+func (c *APIClient) SiteDeviceStatsSubscription(ctx context.Context, siteID string, opts ...SubscribeOption) (*Subscription[StreamedDeviceStat], error) {
+	return subscribeAs[StreamedDeviceStat](ctx, c, fmt.Sprintf("/sites/%s/stats/devices", siteID), opts...)
 }
 
 // GetSiteClientStats fetches and returns a list of all clients configured at a site
 func (c *APIClient) GetSiteClientStats(siteID string) ([]Client, error) {
-	resp, err := c.Get(c.baseURL.JoinPath(fmt.Sprintf("/api/v1/sites/%s/stats/clients", siteID)))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+	return c.GetSiteClientStatsContext(context.Background(), siteID)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, extractError(resp)
-	}
+// GetSiteClientStatsContext is like GetSiteClientStats but bound to the supplied context.
+func (c *APIClient) GetSiteClientStatsContext(ctx context.Context, siteID string) ([]Client, error) {
+	return c.SiteClientStatsPaginator(siteID).Collect(ctx)
+}
 
-	var clients []Client
-	if err := json.NewDecoder(resp.Body).Decode(&clients); err != nil {
-		return nil, err
-	}
+// SiteClientStatsPaginator returns a Paginator over the clients connected at a site.
+func (c *APIClient) SiteClientStatsPaginator(siteID string) *Paginator[Client] {
+	return newPaginator(c, c.baseURL.JoinPath(fmt.Sprintf("/api/v1/sites/%s/stats/clients", siteID)), decodeList[Client])
+}
 
-	return clients, nil
+// AllSiteClients returns an iterator over the clients connected at a site, fetching pages lazily.
+func (c *APIClient) AllSiteClients(ctx context.Context, siteID string) iter.Seq2[Client, error] {
+	return c.SiteClientStatsPaginator(siteID).All(ctx)
 }
 
 // StreamSiteClientStats opens a websocket connection and subscribes to the client statistics stream
-func (c *APIClient) StreamSiteClientStats(ctx context.Context, siteID string) (<-chan StreamedClientStat, error) {
-	return streamStats[StreamedClientStat](ctx, c, fmt.Sprintf("/sites/%s/stats/clients", siteID))
+func (c *APIClient) StreamSiteClientStats(ctx context.Context, siteID string, opts ...SubscribeOption) (<-chan StreamedClientStat, error) {
+	sub, err := c.SiteClientStatsSubscription(ctx, siteID, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return sub.C, nil
+}
+
+// SiteClientStatsSubscription is like StreamSiteClientStats, but returns a handle on the subscription reporting why it ended.
+func (c *APIClient) SiteClientStatsSubscription(ctx context.Context, siteID string, opts ...SubscribeOption) (*Subscription[StreamedClientStat], error) {
+	return subscribeAs[StreamedClientStat](ctx, c, fmt.Sprintf("/sites/%s/stats/clients", siteID), opts...)
 }
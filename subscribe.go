@@ -0,0 +1,98 @@
+package mistclient
+
+import "time"
+
+// SubscribeOption configures optional behaviour of a websocket subscription. Options are passed to
+// Subscribe, the Stream* methods and NewWebsocketSession.
+type SubscribeOption func(*subscribeOptions)
+
+// subscribeOptions holds the settings accumulated from the SubscribeOptions passed to Subscribe.
+type subscribeOptions struct {
+	reconnect   *ReconnectPolicy
+	onReconnect func(ReconnectEvent)
+	onError     func(error)
+	maxChannels int
+	keepalive   time.Duration
+	idleTimeout time.Duration
+	buffer      int
+	overflow    OverflowPolicy
+	coalesceKey func(WebsocketMessage) string
+}
+
+// newSubscribeOptions applies the given options to the defaults.
+func newSubscribeOptions(opts []SubscribeOption) subscribeOptions {
+	so := subscribeOptions{
+		keepalive:   DefaultKeepaliveInterval,
+		idleTimeout: DefaultIdleTimeout,
+		buffer:      DefaultSubscriptionBuffer,
+	}
+	for _, opt := range opts {
+		opt(&so)
+	}
+	return so
+}
+
+// ReconnectPolicy configures how a resilient subscription re-establishes a lost websocket connection.
+//
+// Between attempts the client sleeps for a random duration of up to InitialBackoff * 2^(attempt-1), capped
+// at MaxBackoff, as for RetryPolicy, with the same defaults if unset.
+type ReconnectPolicy struct {
+	// MaxAttempts is the number of consecutive failed attempts after which the subscription gives up and
+	// ends. Zero means no limit.
+	MaxAttempts    int           `yaml:"max_attempts,omitempty"`
+	InitialBackoff time.Duration `yaml:"initial_backoff,omitempty"`
+	MaxBackoff     time.Duration `yaml:"max_backoff,omitempty"`
+}
+
+// DefaultReconnectPolicy retries indefinitely, backing off to at most a minute between attempts.
+var DefaultReconnectPolicy = ReconnectPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+}
+
+// backoff returns a jittered delay to wait before the given (1-based) attempt.
+func (p ReconnectPolicy) backoff(attempt int) time.Duration {
+	return RetryPolicy{InitialBackoff: p.InitialBackoff, MaxBackoff: p.MaxBackoff}.backoff(attempt)
+}
+
+// ReconnectEvent describes progress in re-establishing a subscription whose connection was lost.
+type ReconnectEvent struct {
+	// Channel is the subscribed channel.
+	Channel string
+	// Attempt is the 1-based number of the reconnection attempt since the connection was lost.
+	Attempt int
+	// Delay is the back-off waited before the attempt.
+	Delay time.Duration
+	// Err is the error that ended the connection, or that failed the previous attempt. It is nil once reconnected.
+	Err error
+	// Reconnected reports whether the attempt succeeded and the channel has been resubscribed.
+	Reconnected bool
+}
+
+// WithReconnect makes a subscription resilient: should its websocket connection be lost, the client
+// reconnects with back-off according to the policy and re-sends the subscription request, delivering
+// messages on the same channel as before. Messages sent while disconnected are missed.
+//
+// Only a lost connection is retried; an error establishing the subscription in the first place is
+// returned by Subscribe as usual.
+func WithReconnect(policy ReconnectPolicy) SubscribeOption {
+	return func(so *subscribeOptions) {
+		so.reconnect = &policy
+	}
+}
+
+// WithReconnectHandler sets a function called before each reconnection attempt and once the subscription
+// has been re-established, for example to note that messages may have been missed. It is called from the
+// subscription's receiving goroutine, so should return promptly.
+func WithReconnectHandler(fn func(ReconnectEvent)) SubscribeOption {
+	return func(so *subscribeOptions) {
+		so.onReconnect = fn
+	}
+}
+
+// notify reports a reconnect event to the handler, if any.
+func (so *subscribeOptions) notify(e ReconnectEvent) {
+	if so.onReconnect != nil {
+		so.onReconnect(e)
+	}
+}
@@ -0,0 +1,178 @@
+package mistclient
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// testDroppingWebsocketServer returns a websocket server which, on each connection, subscribes the client,
+// sends a single message numbered by connection and then drops the connection. Connections after the
+// first `healthy` are refused a subscription.
+func testDroppingWebsocketServer(t *testing.T, healthy int32, connections *atomic.Int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+		n := connections.Add(1)
+
+		var subReq SubscriptionRequest
+		if err := websocket.JSON.Receive(ws, &subReq); err != nil {
+			return
+		}
+		if n > healthy {
+			websocket.JSON.Send(ws, SubscriptionResponse{Event: "subscription_failed"})
+			return
+		}
+		websocket.JSON.Send(ws, SubscriptionResponse{Event: "channel_subscribed", Channel: subReq.Subscribe})
+		websocket.JSON.Send(ws, WebsocketMessage{Event: "data", Channel: subReq.Subscribe, Data: fmt.Sprintf("message %d", n)})
+	}))
+}
+
+// testReconnectPolicy reconnects quickly enough for tests.
+var testReconnectPolicy = ReconnectPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+func TestSubscribeReconnect(t *testing.T) {
+	var connections atomic.Int32
+	s := testDroppingWebsocketServer(t, 3, &connections)
+	defer s.Close()
+
+	m := NewPrometheusMetrics()
+	c, err := New(&Config{BaseURL: "https://mist-proxy.example.com", WebsocketURL: "ws" + s.URL[len("http"):], APIKey: "testAPIKey"}, nil,
+		WithMetrics(m))
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	var (
+		mu     sync.Mutex
+		events []ReconnectEvent
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgs, err := c.Subscribe(ctx, "/sites/test-site-id/stats/devices",
+		WithReconnect(testReconnectPolicy),
+		WithReconnectHandler(func(e ReconnectEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		}))
+	if err != nil {
+		t.Fatalf("APIClient.Subscribe(): unexpected error: %v", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				t.Fatalf("APIClient.Subscribe(): channel closed before message %d", i)
+			}
+			if want := fmt.Sprintf("message %d", i); msg.Data != want {
+				t.Errorf("APIClient.Subscribe(): expected %q, got: %q", want, msg.Data)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("APIClient.Subscribe(): timed out waiting for message %d", i)
+		}
+	}
+	cancel()
+	for range msgs {
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var reconnected int
+	for _, e := range events {
+		if e.Channel != "/sites/test-site-id/stats/devices" {
+			t.Errorf("ReconnectEvent: unexpected channel: %q", e.Channel)
+		}
+		if e.Reconnected {
+			reconnected++
+		} else if e.Err == nil {
+			t.Errorf("ReconnectEvent: expected the cause of a reconnection attempt, got: %+v", e)
+		}
+	}
+	if reconnected != 2 {
+		t.Errorf("ReconnectEvent: expected 2 reconnections, got: %d (%+v)", reconnected, events)
+	}
+
+	var b strings.Builder
+	m.WriteTo(&b)
+	if want := `mistclient_websocket_reconnects_total{channel="/sites/:site_id/stats/devices"} 2`; !strings.Contains(b.String(), want) {
+		t.Errorf("Metrics: expected output to contain %q, got:\n%s", want, b.String())
+	}
+}
+
+func TestSubscribeReconnectGivesUp(t *testing.T) {
+	var connections atomic.Int32
+	s := testDroppingWebsocketServer(t, 1, &connections)
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: "https://mist-proxy.example.com", WebsocketURL: "ws" + s.URL[len("http"):], APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	policy := testReconnectPolicy
+	policy.MaxAttempts = 3
+	var attempts atomic.Int32
+	msgs, err := c.Subscribe(context.Background(), "/sites/test-site-id/stats/devices",
+		WithReconnect(policy),
+		WithReconnectHandler(func(e ReconnectEvent) {
+			if !e.Reconnected {
+				attempts.Add(1)
+			}
+		}))
+	if err != nil {
+		t.Fatalf("APIClient.Subscribe(): unexpected error: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range msgs {
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("APIClient.Subscribe(): expected the subscription to end after exhausting its attempts")
+	}
+
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("APIClient.Subscribe(): expected 3 reconnection attempts, got: %d", n)
+	}
+	if n := connections.Load(); n != 4 {
+		t.Errorf("APIClient.Subscribe(): expected 4 connections, got: %d", n)
+	}
+}
+
+func TestSubscribeWithoutReconnect(t *testing.T) {
+	var connections atomic.Int32
+	s := testDroppingWebsocketServer(t, 2, &connections)
+	defer s.Close()
+
+	c, err := New(&Config{BaseURL: "https://mist-proxy.example.com", WebsocketURL: "ws" + s.URL[len("http"):], APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	msgs, err := c.Subscribe(context.Background(), "/sites/test-site-id/stats/devices")
+	if err != nil {
+		t.Fatalf("APIClient.Subscribe(): unexpected error: %v", err)
+	}
+
+	var received int
+	for range msgs {
+		received++
+	}
+	if received != 1 || connections.Load() != 1 {
+		t.Errorf("APIClient.Subscribe(): expected the channel to close after the connection was lost, got %d messages over %d connections", received, connections.Load())
+	}
+}
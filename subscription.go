@@ -0,0 +1,175 @@
+package mistclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrConnectionClosed is reported when Mist closes a websocket connection.
+var ErrConnectionClosed = errors.New("websocket connection closed by server")
+
+// SubscriptionError reports that Mist refused to subscribe to a channel, for example because the channel
+// does not exist or the credentials in use lack access to it.
+type SubscriptionError struct {
+	// Channel is the channel whose subscription was refused.
+	Channel string
+	// Event is the event Mist responded with in place of "channel_subscribed".
+	Event string
+}
+
+// Error implements the error interface.
+func (e *SubscriptionError) Error() string {
+	return fmt.Sprintf("websocket subscription failed: %s", e.Event)
+}
+
+// DecodeError reports a websocket message whose data could not be decoded. It is a non-terminal error,
+// passed to the handler set with WithErrorHandler while the subscription continues.
+type DecodeError struct {
+	// Channel is the channel the message was received on.
+	Channel string
+	// Data is the undecoded message data.
+	Data string
+	// Err is the error returned by the decoder.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode websocket message on %s: %v", e.Channel, e.Err)
+}
+
+// Unwrap returns the underlying decoding error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// WithErrorHandler sets a function called with each non-terminal error encountered by a subscription, such
+// as a *DecodeError for a message that could not be decoded, after which the subscription continues. It is
+// called from the subscription's receiving goroutine, so should return promptly.
+func WithErrorHandler(fn func(error)) SubscribeOption {
+	return func(so *subscribeOptions) {
+		so.onError = fn
+	}
+}
+
+// reportError reports a non-terminal error to the handler, if any.
+func (so *subscribeOptions) reportError(err error) {
+	if so.onError != nil {
+		so.onError(err)
+	}
+}
+
+// Subscription is a handle on a websocket subscription, delivering its messages over C and reporting why it
+// ended once C is closed.
+type Subscription[T any] struct {
+	// C delivers the subscription's messages. It is closed when the subscription ends.
+	C <-chan T
+
+	channel string
+	stop    func() error
+	closed  chan struct{}
+	once    sync.Once
+	dropped *atomic.Uint64
+
+	mu  sync.Mutex
+	err error
+}
+
+// newSubscription returns a handle on a subscription delivering messages over ch, which is ended by stop.
+func newSubscription[T any](channel string, ch <-chan T, stop func() error) *Subscription[T] {
+	return &Subscription[T]{
+		C:       ch,
+		channel: channel,
+		stop:    stop,
+		closed:  make(chan struct{}),
+		dropped: new(atomic.Uint64),
+	}
+}
+
+// Channel returns the subscribed channel.
+func (s *Subscription[T]) Channel() string {
+	return s.channel
+}
+
+// Dropped returns the number of messages received for the subscription but never delivered over C, having
+// been discarded by its overflow policy or because the subscription ended before they could be delivered.
+func (s *Subscription[T]) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Err returns the error that ended the subscription. It returns nil while the subscription is active and if
+// it was ended by Close or by unsubscribing.
+//
+// Otherwise, once C has been closed, the error is the context's error if the context was done, a
+// *SubscriptionError if Mist refused to resubscribe the channel on reconnecting, or the reason the
+// connection was lost, such as ErrConnectionClosed or ErrStaleConnection, wrapped in the final reconnection
+// failure if the subscription was made with WithReconnect.
+func (s *Subscription[T]) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// Close ends the subscription, closing C.
+func (s *Subscription[T]) Close() error {
+	s.once.Do(func() {
+		close(s.closed)
+	})
+	return s.stop()
+}
+
+// finish records the error that ended the subscription. It must be called before C is closed.
+func (s *Subscription[T]) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+// subscribeAs subscribes to a channel over a new websocket connection, decoding the data of each message
+// received as a T. Messages that cannot be decoded are reported to the WithErrorHandler handler and skipped.
+func subscribeAs[T any](ctx context.Context, c *APIClient, channel string, opts ...SubscribeOption) (*Subscription[T], error) {
+	raw, err := c.Subscription(ctx, channel, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to websocket channel %s: %w", channel, err)
+	}
+	so := newSubscribeOptions(opts)
+
+	ch := make(chan T)
+	sub := newSubscription(channel, ch, raw.Close)
+	sub.dropped = raw.dropped
+
+	go func() {
+		defer close(ch)
+
+		for msg := range raw.C {
+			var v T
+			if err := json.Unmarshal([]byte(msg.Data), &v); err != nil {
+				c.metrics.IncDecodeErrors(channelTemplate(channel))
+				c.logger.Error("failed to unmarshal websocket message", "channel", channel, "error", err)
+				so.reportError(&DecodeError{Channel: channel, Data: msg.Data, Err: err})
+				continue
+			}
+			select {
+			case ch <- v:
+			case <-ctx.Done():
+				sub.dropped.Add(1)
+				c.metrics.IncMessagesDropped(channelTemplate(channel))
+				sub.finish(ctx.Err())
+				return
+			case <-sub.closed:
+				sub.dropped.Add(1)
+				c.metrics.IncMessagesDropped(channelTemplate(channel))
+				return
+			}
+		}
+		sub.finish(raw.Err())
+	}()
+
+	return sub, nil
+}
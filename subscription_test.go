@@ -0,0 +1,140 @@
+package mistclient
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+// testBurstWebsocketServer returns a websocket server which subscribes the client, sends a data message for
+// each of data in quick succession and then closes the connection.
+func testBurstWebsocketServer(t *testing.T, data ...string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		var subReq SubscriptionRequest
+		if err := websocket.JSON.Receive(ws, &subReq); err != nil {
+			return
+		}
+		websocket.JSON.Send(ws, SubscriptionResponse{Event: "channel_subscribed", Channel: subReq.Subscribe})
+		for _, d := range data {
+			websocket.JSON.Send(ws, WebsocketMessage{Event: "data", Channel: subReq.Subscribe, Data: d})
+		}
+	}))
+}
+
+func TestSubscriptionErr(t *testing.T) {
+	var connections atomic.Int32
+	s := testDroppingWebsocketServer(t, 2, &connections)
+	defer s.Close()
+	c := newWebsocketTestClient(t, s)
+
+	t.Run("Connection closed", func(t *testing.T) {
+		sub, err := c.Subscription(context.Background(), "/sites/test-site-id/stats/devices")
+		if err != nil {
+			t.Fatalf("APIClient.Subscription(): unexpected error: %v", err)
+		}
+		receive(t, sub.C)
+		expectClosed(t, sub.C)
+		if err := sub.Err(); !errors.Is(err, ErrConnectionClosed) {
+			t.Errorf("Subscription.Err(): expected ErrConnectionClosed, got: %v", err)
+		}
+	})
+
+	t.Run("Refused on reconnecting", func(t *testing.T) {
+		policy := testReconnectPolicy
+		policy.MaxAttempts = 2
+		sub, err := c.Subscription(context.Background(), "/sites/test-site-id/stats/devices", WithReconnect(policy))
+		if err != nil {
+			t.Fatalf("APIClient.Subscription(): unexpected error: %v", err)
+		}
+		receive(t, sub.C)
+		expectClosed(t, sub.C)
+
+		var subErr *SubscriptionError
+		if err := sub.Err(); !errors.As(err, &subErr) || subErr.Event != "subscription_failed" || subErr.Channel != sub.Channel() {
+			t.Errorf("Subscription.Err(): expected a *SubscriptionError, got: %v", err)
+		}
+	})
+
+	mux := newTestMuxServer(t)
+	defer mux.Close()
+	c = newWebsocketTestClient(t, mux.Server)
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		sub, err := c.Subscription(ctx, "/sites/test-site-id/stats/devices")
+		if err != nil {
+			t.Fatalf("APIClient.Subscription(): unexpected error: %v", err)
+		}
+		if err := sub.Err(); err != nil {
+			t.Errorf("Subscription.Err(): expected nil for an active subscription, got: %v", err)
+		}
+		cancel()
+		expectClosed(t, sub.C)
+		if err := sub.Err(); !errors.Is(err, context.Canceled) {
+			t.Errorf("Subscription.Err(): expected context.Canceled, got: %v", err)
+		}
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		sub, err := c.Subscription(context.Background(), "/sites/test-site-id/stats/devices")
+		if err != nil {
+			t.Fatalf("APIClient.Subscription(): unexpected error: %v", err)
+		}
+		if err := sub.Close(); err != nil {
+			t.Errorf("Subscription.Close(): unexpected error: %v", err)
+		}
+		expectClosed(t, sub.C)
+		if err := sub.Err(); err != nil {
+			t.Errorf("Subscription.Err(): expected nil once closed, got: %v", err)
+		}
+	})
+}
+
+func TestSubscriptionDecodeErrors(t *testing.T) {
+	s := testBurstWebsocketServer(t, `{"mac": 5c5b35000001}`, `{"mac": "5c5b35000001"}`)
+	defer s.Close()
+	c := newWebsocketTestClient(t, s)
+
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	sub, err := c.SiteDeviceStatsSubscription(context.Background(), "test-site-id",
+		WithErrorHandler(func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		}))
+	if err != nil {
+		t.Fatalf("APIClient.SiteDeviceStatsSubscription(): unexpected error: %v", err)
+	}
+
+	var stats []StreamedDeviceStat
+	for stat := range sub.C {
+		stats = append(stats, stat)
+	}
+	if len(stats) != 1 || stats[0].Mac != "5c5b35000001" {
+		t.Errorf("Subscription.C: expected the valid message only, got: %+v", stats)
+	}
+	if err := sub.Err(); !errors.Is(err, ErrConnectionClosed) {
+		t.Errorf("Subscription.Err(): expected ErrConnectionClosed, got: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var decodeErr *DecodeError
+	if len(errs) != 1 || !errors.As(errs[0], &decodeErr) || decodeErr.Channel != "/sites/test-site-id/stats/devices" {
+		t.Fatalf("WithErrorHandler: expected a single *DecodeError, got: %v", errs)
+	}
+	if decodeErr.Data != `{"mac": 5c5b35000001}` {
+		t.Errorf("DecodeError.Data: expected the undecoded message, got: %q", decodeErr.Data)
+	}
+}
@@ -0,0 +1,188 @@
+package mistclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// TokenStatus is a snapshot of the state of an API token in the client's token pool.
+type TokenStatus struct {
+	// Token identifies the API token by its last four characters.
+	Token string
+	// Requests is the number of requests made with the token.
+	Requests int64
+	// RateLimited is the number of 429 responses received for the token.
+	RateLimited int64
+	// RetiredUntil is the time until which the token is withheld following a 429 response.
+	RetiredUntil time.Time
+	// Available reports whether the token is currently in use.
+	Available bool
+}
+
+// pooledToken is an API token and its usage state.
+type pooledToken struct {
+	key          string
+	requests     int64
+	rateLimited  int64
+	retiredUntil time.Time
+}
+
+// tokenPool spreads requests across several API tokens in round-robin order, withholding any token that
+// has exhausted its hourly quota until its window resets.
+type tokenPool struct {
+	mu     sync.Mutex
+	tokens []*pooledToken
+	next   int
+
+	now func() time.Time
+}
+
+// newTokenPool returns a pool of the given API tokens. Duplicate and empty tokens are discarded, though
+// a pool always holds at least one token.
+func newTokenPool(keys ...string) *tokenPool {
+	p := &tokenPool{now: time.Now}
+
+	var seen []string
+	for _, key := range keys {
+		if key == "" || slices.Contains(seen, key) {
+			continue
+		}
+		seen = append(seen, key)
+		p.tokens = append(p.tokens, &pooledToken{key: key})
+	}
+	if len(p.tokens) == 0 {
+		p.tokens = append(p.tokens, &pooledToken{})
+	}
+
+	return p
+}
+
+// size returns the number of tokens in the pool.
+func (p *tokenPool) size() int {
+	return len(p.tokens)
+}
+
+// acquire returns the next available token, blocking until one becomes available if all have been
+// retired, or the context is done. Should the wait extend beyond the context's deadline, it fails straight away.
+func (p *tokenPool) acquire(ctx context.Context) (string, error) {
+	for {
+		key, wait := p.pick()
+		if wait <= 0 {
+			return key, nil
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return "", fmt.Errorf("%w: every API token retired for %s, beyond the deadline: %w", ErrRateLimited, wait.Round(time.Millisecond), context.DeadlineExceeded)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return "", ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// pick selects the next available token in round-robin order. If every token is retired, it returns
+// the time until the first becomes available again.
+func (p *tokenPool) pick() (string, time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	var soonest time.Time
+	for range p.tokens {
+		t := p.tokens[p.next]
+		p.next = (p.next + 1) % len(p.tokens)
+
+		if !now.Before(t.retiredUntil) {
+			t.requests++
+			return t.key, 0
+		}
+		if soonest.IsZero() || t.retiredUntil.Before(soonest) {
+			soonest = t.retiredUntil
+		}
+	}
+
+	return "", soonest.Sub(now)
+}
+
+// wait returns the time until a token becomes available, or zero if one is available now.
+func (p *tokenPool) wait() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	var soonest time.Time
+	for _, t := range p.tokens {
+		if !now.Before(t.retiredUntil) {
+			return 0
+		}
+		if soonest.IsZero() || t.retiredUntil.Before(soonest) {
+			soonest = t.retiredUntil
+		}
+	}
+	return soonest.Sub(now)
+}
+
+// retire withholds a token until the given time, following a 429 response.
+func (p *tokenPool) retire(key string, until time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, t := range p.tokens {
+		if t.key == key {
+			t.rateLimited++
+			if until.After(t.retiredUntil) {
+				t.retiredUntil = until
+			}
+			return
+		}
+	}
+}
+
+// status returns a snapshot of the state of every token in the pool.
+func (p *tokenPool) status() []TokenStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	statuses := make([]TokenStatus, 0, len(p.tokens))
+	for _, t := range p.tokens {
+		statuses = append(statuses, TokenStatus{
+			Token:        maskToken(t.key),
+			Requests:     t.requests,
+			RateLimited:  t.rateLimited,
+			RetiredUntil: t.retiredUntil,
+			Available:    !now.Before(t.retiredUntil),
+		})
+	}
+	return statuses
+}
+
+// maskToken returns the last four characters of an API token, for use in logs and monitoring.
+func maskToken(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return "****" + key[len(key)-4:]
+}
+
+// quotaReset returns the time at which a token's hourly quota window resets following a 429 response,
+// taken from the Retry-After header where present, and otherwise the start of the next hour.
+func quotaReset(resp *http.Response, now time.Time) time.Time {
+	if resp.Header.Get("Retry-After") != "" {
+		return retryAfter(resp.Header, now)
+	}
+	return now.Truncate(quotaWindow).Add(quotaWindow)
+}
+
+// TokenPool returns a snapshot of the state of each API token in the client's token pool, for monitoring.
+func (c *APIClient) TokenPool() []TokenStatus {
+	return c.tokens.status()
+}
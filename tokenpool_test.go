@@ -0,0 +1,152 @@
+package mistclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTokenPoolRoundRobin(t *testing.T) {
+	p := newTokenPool("key-1", "key-2", "", "key-1", "key-3")
+	if p.size() != 3 {
+		t.Fatalf("newTokenPool(): expected 3 unique tokens, got: %d", p.size())
+	}
+
+	var got []string
+	for range 6 {
+		key, err := p.acquire(context.Background())
+		if err != nil {
+			t.Fatalf("tokenPool.acquire(): unexpected error: %v", err)
+		}
+		got = append(got, key)
+	}
+	if want := "key-1 key-2 key-3 key-1 key-2 key-3"; strings.Join(got, " ") != want {
+		t.Errorf("tokenPool.acquire(): expected order %q, got: %q", want, strings.Join(got, " "))
+	}
+}
+
+func TestTokenPoolRetire(t *testing.T) {
+	now := time.Date(2025, 8, 7, 12, 0, 0, 0, time.UTC)
+	p := newTokenPool("key-1", "key-2")
+	p.now = func() time.Time { return now }
+
+	p.retire("key-1", now.Add(time.Minute))
+	for range 3 {
+		if key, _ := p.pick(); key != "key-2" {
+			t.Fatalf("tokenPool.pick(): expected retired token to be skipped, got: %s", key)
+		}
+	}
+
+	p.retire("key-2", now.Add(2*time.Minute))
+	if key, wait := p.pick(); key != "" || wait != time.Minute {
+		t.Errorf("tokenPool.pick(): expected to wait 1m for the first token, got: %q, %s", key, wait)
+	}
+	if wait := p.wait(); wait != time.Minute {
+		t.Errorf("tokenPool.wait(): expected 1m, got: %s", wait)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("tokenPool.acquire(): expected context.Canceled while all tokens retired, got: %v", err)
+	}
+
+	// A wait beyond the context's deadline fails straight away.
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := p.acquire(ctx); !errors.Is(err, ErrRateLimited) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("tokenPool.acquire(): expected ErrRateLimited and context.DeadlineExceeded, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("tokenPool.acquire(): expected to fail without waiting, took %s", elapsed)
+	}
+
+	now = now.Add(time.Minute)
+	if key, _ := p.pick(); key != "key-1" {
+		t.Errorf("tokenPool.pick(): expected key-1 to return after its window, got: %q", key)
+	}
+
+	status := p.status()
+	if len(status) != 2 {
+		t.Fatalf("tokenPool.status(): expected 2 tokens, got: %d", len(status))
+	}
+	if status[0].Token != "****ey-1" || !status[0].Available || status[0].RateLimited != 1 {
+		t.Errorf("tokenPool.status()[0]: unexpected status: %+v", status[0])
+	}
+	if status[1].Available || status[1].Requests != 3 {
+		t.Errorf("tokenPool.status()[1]: unexpected status: %+v", status[1])
+	}
+}
+
+func TestQuotaReset(t *testing.T) {
+	now := time.Date(2025, 8, 7, 12, 34, 56, 0, time.UTC)
+
+	resp := &http.Response{Header: http.Header{}}
+	if got, want := quotaReset(resp, now), time.Date(2025, 8, 7, 13, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("quotaReset(): expected next hour %s, got: %s", want, got)
+	}
+
+	resp.Header.Set("Retry-After", "120")
+	if got, want := quotaReset(resp, now), now.Add(2*time.Minute); !got.Equal(want) {
+		t.Errorf("quotaReset(): expected Retry-After %s, got: %s", want, got)
+	}
+}
+
+func TestTokenPoolRotation(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		mu.Lock()
+		seen = append(seen, auth)
+		mu.Unlock()
+
+		if auth == "Token exhausted-key" {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer s.Close()
+
+	c, err := New(&Config{
+		BaseURL: s.URL,
+		APIKey:  "exhausted-key",
+		APIKeys: []string{"fresh-key"},
+		Retry:   RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond},
+	}, nil)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	for range 3 {
+		if _, err := c.GetSelf(); err != nil {
+			t.Fatalf("APIClient.GetSelf(): unexpected error: %v", err)
+		}
+	}
+
+	want := []string{"Token exhausted-key", "Token fresh-key", "Token fresh-key", "Token fresh-key"}
+	if strings.Join(seen, ",") != strings.Join(want, ",") {
+		t.Errorf("expected requests with tokens %v, got: %v", want, seen)
+	}
+
+	status := c.TokenPool()
+	if status[0].Available || status[0].RateLimited != 1 {
+		t.Errorf("APIClient.TokenPool()[0]: expected exhausted token to be retired, got: %+v", status[0])
+	}
+	if !status[1].Available || status[1].Requests != 3 {
+		t.Errorf("APIClient.TokenPool()[1]: expected fresh token to serve 3 requests, got: %+v", status[1])
+	}
+	if blocked := c.RateLimit().BlockedUntil; !blocked.IsZero() {
+		t.Errorf("APIClient.RateLimit().BlockedUntil: expected requests not to be paused, got: %s", blocked)
+	}
+}
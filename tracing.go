@@ -0,0 +1,142 @@
+package mistclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the client as the source of its OpenTelemetry spans.
+const instrumentationName = "github.com/gregwight/mistclient"
+
+// Span attributes describing Mist API operations.
+const (
+	attrEndpoint  = attribute.Key("mist.endpoint")
+	attrOrgID     = attribute.Key("mist.org_id")
+	attrSiteID    = attribute.Key("mist.site_id")
+	attrCacheHit  = attribute.Key("mist.cache_hit")
+	attrCoalesced = attribute.Key("mist.coalesced")
+	attrChannel   = attribute.Key("mist.channel")
+	attrEvent     = attribute.Key("mist.event")
+	attrSize      = attribute.Key("mist.message_size")
+	attrAttempt   = attribute.Key("mist.reconnect_attempt")
+)
+
+// WithTracerProvider sets the OpenTelemetry tracer provider used to trace REST requests and websocket
+// subscriptions. By default the global tracer provider is used, so spans are only recorded if the
+// application has registered one.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = tp
+	}
+}
+
+// WithPropagator sets the propagator used to pass trace context to the Mist API on REST requests and the
+// websocket handshake. The default is W3C Trace Context.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(o *options) {
+		o.propagator = p
+	}
+}
+
+// configureTracing sets up the tracer and propagator from the supplied options.
+func (c *APIClient) configureTracing(o *options) {
+	tp := o.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	c.tracer = tp.Tracer(instrumentationName)
+
+	c.propagator = o.propagator
+	if c.propagator == nil {
+		c.propagator = propagation.TraceContext{}
+	}
+}
+
+// startRequestSpan starts a client span covering a REST call, including any retries, named after the
+// method and endpoint template as recommended by the OpenTelemetry HTTP semantic conventions.
+func (c *APIClient) startRequestSpan(ctx context.Context, method string, u *url.URL) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(method),
+		semconv.URLFull(u.String()),
+		semconv.ServerAddress(u.Hostname()),
+	}
+
+	name := method
+	if endpoint, params, ok := matchEndpoint(requestPath(u)); ok {
+		name += " " + endpoint
+		attrs = append(attrs, attrEndpoint.String(endpoint))
+		if orgID, ok := params["org_id"]; ok {
+			attrs = append(attrs, attrOrgID.String(orgID))
+		}
+		if siteID, ok := params["site_id"]; ok {
+			attrs = append(attrs, attrSiteID.String(siteID))
+		}
+	}
+
+	return c.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endRequestSpan records the outcome of a REST call on its span and ends it.
+func endRequestSpan(span trace.Span, resp *http.Response, err error) {
+	defer span.End()
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+}
+
+// propagateTrace is middleware that injects the trace context into each attempt of a request, and
+// records the number of retries on the request's span.
+func (c *APIClient) propagateTrace(next Handler) Handler {
+	return func(r *Request) (*http.Response, error) {
+		c.propagator.Inject(r.Context(), propagation.HeaderCarrier(r.Header))
+		if r.Attempt > 1 {
+			trace.SpanFromContext(r.Context()).SetAttributes(semconv.HTTPRequestResendCount(r.Attempt - 1))
+		}
+
+		return next(r)
+	}
+}
+
+// startSubscriptionSpan starts a long-lived span covering a websocket subscription. As for REST spans, the
+// span is named after the channel's template, keeping span names low-cardinality, and the concrete channel
+// is recorded as an attribute.
+func (c *APIClient) startSubscriptionSpan(ctx context.Context, channel string) (context.Context, trace.Span) {
+	return c.tracer.Start(ctx, "subscribe "+channelTemplate(channel),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrChannel.String(channel)),
+	)
+}
+
+// recordMessage adds an event for a received websocket message to a subscription span.
+func recordMessage(span trace.Span, msg WebsocketMessage) {
+	span.AddEvent("message", trace.WithAttributes(
+		attrEvent.String(msg.Event),
+		attrChannel.String(msg.Channel),
+		attrSize.Int(len(msg.Data)),
+	))
+}
+
+// endSpanWithError records an error on a span, if any, and ends it.
+func endSpanWithError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,168 @@
+package mistclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spanAttr returns the value of the named attribute of a span, if present.
+func spanAttr(span sdktrace.ReadOnlySpan, key string) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTracingREST(t *testing.T) {
+	var (
+		requests    atomic.Int32
+		traceparent atomic.Value
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent.Store(r.Header.Get("Traceparent"))
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer s.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey", Retry: RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}}, nil,
+		WithTracerProvider(tp))
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	if _, err := c.GetOrgAPITokenContext(ctx, "test-org-id", "test-token-id"); err != nil {
+		t.Fatalf("APIClient.GetOrgAPITokenContext(): unexpected error: %v", err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Tracing: expected 2 spans, got: %d", len(spans))
+	}
+	span := spans[0]
+
+	if want := "GET " + EndpointOrgAPIToken; span.Name() != want {
+		t.Errorf("Tracing: expected span name %q, got: %q", want, span.Name())
+	}
+	if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("Tracing: expected span to be a child of the caller's span")
+	}
+	for key, want := range map[string]string{
+		"http.request.method": "GET",
+		"mist.endpoint":       EndpointOrgAPIToken,
+		"mist.org_id":         "test-org-id",
+	} {
+		if v, ok := spanAttr(span, key); !ok || v.AsString() != want {
+			t.Errorf("Tracing: expected attribute %s=%q, got: %q", key, want, v.AsString())
+		}
+	}
+	if v, _ := spanAttr(span, "http.response.status_code"); v.AsInt64() != http.StatusOK {
+		t.Errorf("Tracing: expected status code 200, got: %d", v.AsInt64())
+	}
+	if v, _ := spanAttr(span, "http.request.resend_count"); v.AsInt64() != 1 {
+		t.Errorf("Tracing: expected resend count 1, got: %d", v.AsInt64())
+	}
+
+	got, _ := traceparent.Load().(string)
+	if !strings.Contains(got, span.SpanContext().TraceID().String()) {
+		t.Errorf("Tracing: expected traceparent carrying trace ID %s, got: %q", span.SpanContext().TraceID(), got)
+	}
+}
+
+func TestTracingRESTError(t *testing.T) {
+	c, recorder := newTracedTestClient(t)
+
+	if _, err := c.GetOrgSites("random-org-id"); err == nil {
+		t.Fatalf("APIClient.GetOrgSites(): expected error")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Tracing: expected 1 span, got: %d", len(spans))
+	}
+	if spans[0].Status().Code != codes.Error {
+		t.Errorf("Tracing: expected error status, got: %v", spans[0].Status())
+	}
+}
+
+func TestTracingSubscription(t *testing.T) {
+	wsServer := testWebsocketServer(t, false, "one", "two")
+	defer wsServer.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	c, err := New(&Config{BaseURL: "https://mist-proxy.example.com", WebsocketURL: "ws" + wsServer.URL[len("http"):], APIKey: "testAPIKey"}, nil,
+		WithTracerProvider(tp))
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	msgs, err := c.Subscribe(ctx, "/sites/test-site-id/devices")
+	if err != nil {
+		t.Fatalf("APIClient.Subscribe(): unexpected error: %v", err)
+	}
+	for range 2 {
+		<-msgs
+	}
+	cancel()
+	for range msgs {
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Tracing: expected 1 subscription span, got: %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "subscribe /sites/:site_id/devices" {
+		t.Errorf("Tracing: unexpected span name: %q", span.Name())
+	}
+	if v, _ := spanAttr(span, "mist.channel"); v.AsString() != "/sites/test-site-id/devices" {
+		t.Errorf("Tracing: expected channel attribute /sites/test-site-id/devices, got: %q", v.AsString())
+	}
+	if n := len(span.Events()); n != 2 {
+		t.Errorf("Tracing: expected 2 message events, got: %d", n)
+	}
+	if span.Status().Code == codes.Error {
+		t.Errorf("Tracing: expected cancelled subscription not to be an error, got: %v", span.Status())
+	}
+}
+
+// newTracedTestClient returns a test client recording its spans.
+func newTracedTestClient(t *testing.T) (*APIClient, *tracetest.SpanRecorder) {
+	t.Helper()
+
+	s := testAPIServer(t)
+	t.Cleanup(s.Close)
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	c, err := New(&Config{BaseURL: s.URL, APIKey: "testAPIKey"}, nil, WithTracerProvider(tp))
+	if err != nil {
+		t.Fatalf("newTracedTestClient: unexpected error: %v", err)
+	}
+
+	return c, recorder
+}
@@ -0,0 +1,862 @@
+package mistclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/websocket"
+)
+
+// DefaultMaxChannelsPerConnection is the number of channels a WebsocketSession subscribes to over a single
+// websocket connection before opening another, unless set with WithMaxChannelsPerConnection.
+const DefaultMaxChannelsPerConnection = 100
+
+// Websocket event types sent by Mist.
+const (
+	eventData              = "data"
+	eventChannelSubscribed = "channel_subscribed"
+)
+
+// ErrSessionClosed is returned when subscribing through a WebsocketSession that has been closed.
+var ErrSessionClosed = errors.New("websocket session closed")
+
+// errConnectionLost is reported to a subscription request whose connection was lost awaiting the response.
+var errConnectionLost = errors.New("websocket connection lost")
+
+// errShardIdle is returned by reconnect when every channel of a lost connection has been unsubscribed, so
+// there is nothing left to reconnect and the shard is closed quietly.
+var errShardIdle = errors.New("no websocket channels left to resubscribe")
+
+// errUnsubscribed is reported to a subscription request whose channel was unsubscribed before it completed.
+var errUnsubscribed = errors.New("websocket channel unsubscribed while subscribing")
+
+// WithMaxChannelsPerConnection sets the number of channels a WebsocketSession subscribes to over each
+// websocket connection, opening further connections as required. It has no effect on Subscribe.
+func WithMaxChannelsPerConnection(n int) SubscribeOption {
+	return func(so *subscribeOptions) {
+		so.maxChannels = n
+	}
+}
+
+// WebsocketSession multiplexes subscriptions to many channels over a small number of websocket connections,
+// routing each received message to the Go channel of the subscription it belongs to.
+//
+// Channels are added to the session's current connection until it carries the maximum number of channels
+// per connection, when a further connection is opened ("sharding"). A connection is closed once its last
+// channel is unsubscribed. Should a connection be lost, its channels are closed, unless the session was
+// opened with WithReconnect, in which case it is re-established and every channel on it resubscribed.
+//
+// Each connection is pinged periodically, and one that receives nothing within the idle timeout is treated
+// as lost, so that a half-open connection is not mistaken for a quiet channel (see WithKeepalive and
+// WithIdleTimeout).
+//
+// Messages are delivered in the order received on each connection. Each subscription buffers messages
+// awaiting delivery (see WithBuffer). By default, a subscriber that does not keep up once its buffer is full
+// holds back delivery to the other channels sharing its connection, unless a WithOverflowPolicy discarding
+// or coalescing messages is set.
+type WebsocketSession struct {
+	c             *APIClient
+	so            subscribeOptions
+	parent        context.Context
+	ctx           context.Context
+	cancel        context.CancelFunc
+	closeWhenIdle bool
+
+	// ops serialises Unsubscribe, Close and the registration of new connections. It is not held while
+	// connecting or awaiting subscription responses, so a slow subscription holds up neither.
+	ops sync.Mutex
+
+	mu     sync.Mutex
+	shards []*wsShard
+	subs   map[string]*channelSub
+	closed bool
+
+	wg sync.WaitGroup
+}
+
+// NewWebsocketSession returns a session for subscribing to websocket channels. No connection is made until
+// the first channel is subscribed. The session is closed, ending every subscription, when the context is
+// done or Close is called.
+func (c *APIClient) NewWebsocketSession(ctx context.Context, opts ...SubscribeOption) *WebsocketSession {
+	so := newSubscribeOptions(opts)
+	if so.maxChannels < 1 {
+		so.maxChannels = DefaultMaxChannelsPerConnection
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	s := &WebsocketSession{
+		c:      c,
+		so:     so,
+		parent: parent,
+		ctx:    ctx,
+		cancel: cancel,
+		subs:   make(map[string]*channelSub),
+	}
+	context.AfterFunc(ctx, func() {
+		s.close(parent.Err())
+	})
+
+	return s
+}
+
+// Subscribe subscribes the session to a channel, returning a Go channel over which its messages will be
+// sent. The Go channel is closed when the channel is unsubscribed, the session is closed, or the connection
+// carrying it is lost without being re-established. The context bounds the subscription request only.
+//
+// The subscription is traced with a span lasting until it ends, with an event for each message received.
+// Use Subscription for a handle reporting why the subscription ended.
+func (s *WebsocketSession) Subscribe(ctx context.Context, channel string) (<-chan WebsocketMessage, error) {
+	sub, err := s.Subscription(ctx, channel)
+	if err != nil {
+		return nil, err
+	}
+	return sub.C, nil
+}
+
+// Subscription is like Subscribe, but returns a handle on the subscription whose Err method reports why it
+// ended, and whose Close method unsubscribes the channel.
+func (s *WebsocketSession) Subscription(ctx context.Context, channel string) (*Subscription[WebsocketMessage], error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	if _, ok := s.subs[channel]; ok {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("already subscribed to websocket channel %s", channel)
+	}
+	_, span := s.c.startSubscriptionSpan(ctx, channel)
+	sub := &channelSub{
+		s:       s,
+		channel: channel,
+		span:    span,
+		ch:      make(chan WebsocketMessage),
+		done:    make(chan struct{}),
+		abort:   make(chan struct{}),
+		ready:   make(chan struct{}, 1),
+		space:   make(chan struct{}, 1),
+		keys:    make(map[string]*queued),
+	}
+	sub.handle = newSubscription(channel, sub.ch, func() error {
+		return s.unsubscribe(sub)
+	})
+	s.subs[channel] = sub
+	go sub.pump()
+	// Reserve room for the channel on a connection, or a new connection for it, so that subscriptions made
+	// meanwhile do not overfill the connection.
+	shard := s.available()
+	connected := shard != nil
+	if !connected {
+		shard = s.newShard()
+	}
+	sub.shard = shard
+	shard.mu.Lock()
+	shard.channels[channel] = sub
+	shard.mu.Unlock()
+	s.mu.Unlock()
+	s.c.metrics.AddSubscriptions(1)
+
+	var err error
+	if connected {
+		err = shard.subscribe(ctx, sub)
+	} else {
+		err = s.connect(ctx, shard, sub)
+	}
+
+	s.mu.Lock()
+	closed, current := s.closed, s.subs[channel] == sub
+	if err == nil && !current {
+		err = errUnsubscribed
+	}
+	if err != nil && current {
+		delete(s.subs, channel)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		if closed {
+			err = ErrSessionClosed
+		}
+		sub.end(err)
+		return nil, err
+	}
+	s.c.logger.Debug("successfully subscribed to websocket channel", "channel", channel)
+
+	return sub.handle, nil
+}
+
+// Unsubscribe unsubscribes the session from a channel, closing its Go channel.
+func (s *WebsocketSession) Unsubscribe(channel string) error {
+	s.mu.Lock()
+	sub, ok := s.subs[channel]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("not subscribed to websocket channel %s", channel)
+	}
+
+	return s.unsubscribe(sub)
+}
+
+// unsubscribe unsubscribes a subscription, unless it has already ended.
+func (s *WebsocketSession) unsubscribe(sub *channelSub) error {
+	s.ops.Lock()
+	defer s.ops.Unlock()
+
+	s.mu.Lock()
+	ok := s.subs[sub.channel] == sub
+	if ok {
+		delete(s.subs, sub.channel)
+	}
+	idle := len(s.subs) == 0
+	shard := sub.shard
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	err := shard.unsubscribe(sub)
+	sub.end(nil)
+	if idle && s.closeWhenIdle {
+		s.cancel()
+	}
+
+	return err
+}
+
+// Channels returns the channels the session is subscribed to, in order.
+func (s *WebsocketSession) Channels() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channels := make([]string, 0, len(s.subs))
+	for channel := range s.subs {
+		channels = append(channels, channel)
+	}
+	slices.Sort(channels)
+	return channels
+}
+
+// Connections returns the number of websocket connections held by the session.
+func (s *WebsocketSession) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.shards)
+}
+
+// Close unsubscribes from every channel and closes the session's connections.
+func (s *WebsocketSession) Close() error {
+	return s.close(nil)
+}
+
+// close closes the session, ending every subscription with the given error.
+func (s *WebsocketSession) close(err error) error {
+	s.ops.Lock()
+	defer s.ops.Unlock()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	shards, subs := s.shards, s.subs
+	s.shards, s.subs = nil, make(map[string]*channelSub)
+	s.mu.Unlock()
+
+	s.cancel()
+	for _, shard := range shards {
+		shard.shutdown()
+	}
+	for _, sub := range subs {
+		sub.end(err)
+	}
+	s.wg.Wait()
+
+	return nil
+}
+
+// available returns a connected shard with room for another channel, if any. The caller must hold s.mu.
+func (s *WebsocketSession) available() *wsShard {
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+		ok := !shard.down && !shard.closing && len(shard.channels) < s.so.maxChannels
+		shard.mu.Unlock()
+		if ok {
+			return shard
+		}
+	}
+	return nil
+}
+
+// newShard returns a shard for a connection yet to be opened by connect. The caller must hold s.mu.
+func (s *WebsocketSession) newShard() *wsShard {
+	return &wsShard{
+		s:        s,
+		channels: make(map[string]*channelSub),
+		acks:     make(chan SubscriptionResponse, 1),
+		lost:     make(chan struct{}),
+		down:     true,
+	}
+}
+
+// connect opens the connection of a new shard carrying the given subscription, and registers the shard
+// with the session once the channel is subscribed. Closing the session abandons the attempt.
+func (s *WebsocketSession) connect(ctx context.Context, shard *wsShard, sub *channelSub) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(s.ctx, cancel)
+	defer stop()
+
+	conn, activity, err := s.c.connectWebSocket(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to websocket: %w", err)
+	}
+	s.c.logger.Debug("successfully connected to websocket", "url", conn.Config().Location.String())
+
+	stopHandshake := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	err = shard.handshake(conn, sub.channel)
+	if !stopHandshake() {
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	s.ops.Lock()
+	defer s.ops.Unlock()
+
+	s.mu.Lock()
+	shard.mu.Lock()
+	// The channel may have been unsubscribed, closing the shard, while it was being subscribed.
+	ok := !s.closed && !shard.closing
+	if ok {
+		shard.conn, shard.down = conn, false
+	}
+	shard.mu.Unlock()
+	if ok {
+		s.shards = append(s.shards, shard)
+	}
+	s.mu.Unlock()
+	if !ok {
+		conn.Close()
+		return errUnsubscribed
+	}
+	s.c.metrics.AddWebsocketConnections(1)
+
+	s.wg.Add(1)
+	go shard.run(conn, activity)
+
+	return nil
+}
+
+// channelSub is a session's subscription to a single channel.
+type channelSub struct {
+	s       *WebsocketSession
+	shard   *wsShard
+	channel string
+	span    trace.Span
+	handle  *Subscription[WebsocketMessage]
+
+	// ch is sent buffered messages by pump, and done closed once the subscription has ended. abort is
+	// closed should messages still buffered then be discarded rather than delivered.
+	ch    chan WebsocketMessage
+	done  chan struct{}
+	abort chan struct{}
+
+	// ready and space signal pump that a message has been buffered, and deliver that one has been taken.
+	ready chan struct{}
+	space chan struct{}
+
+	mu    sync.Mutex
+	queue []*queued
+	keys  map[string]*queued
+	ended bool
+	once  sync.Once
+}
+
+// end ends the subscription with the error to be reported by its handle, closing its Go channel once any
+// buffered messages have been delivered. Buffered messages are discarded instead if the subscription was
+// closed, unsubscribed or its context done. The error is recorded on the subscription's span unless it is
+// that of the session's context being done.
+func (sub *channelSub) end(err error) {
+	sub.once.Do(func() {
+		cancelled := err != nil && err == sub.s.parent.Err()
+		if cancelled {
+			endSpanWithError(sub.span, nil)
+		} else {
+			endSpanWithError(sub.span, err)
+		}
+		sub.s.c.metrics.AddSubscriptions(-1)
+
+		sub.mu.Lock()
+		sub.ended = true
+		sub.handle.finish(err)
+		sub.mu.Unlock()
+
+		close(sub.done)
+		if err == nil || cancelled {
+			close(sub.abort)
+		}
+		signal(sub.ready)
+	})
+}
+
+// wsShard is one of a session's websocket connections, along with the channels subscribed over it.
+type wsShard struct {
+	s *WebsocketSession
+
+	mu       sync.Mutex
+	conn     *websocket.Conn
+	channels map[string]*channelSub
+	pending  string
+	down     bool
+	closing  bool
+	lost     chan struct{}
+	stale    error
+
+	writeMu sync.Mutex
+	acks    chan SubscriptionResponse
+
+	// subMu serialises subscription requests over the connection, as responses are matched to pending.
+	subMu sync.Mutex
+
+	// blocked counts deliveries waiting on a slow subscriber under OverflowBlock, holding up the reading of
+	// the connection, and unblocked records when the last of them ended, as UnixNano.
+	blocked   atomic.Int32
+	unblocked atomic.Int64
+}
+
+// send writes a request to a connection of the shard.
+func (sh *wsShard) send(conn *websocket.Conn, v any) error {
+	sh.writeMu.Lock()
+	defer sh.writeMu.Unlock()
+
+	conn.SetWriteDeadline(time.Now().Add(sh.s.c.timeout))
+	defer conn.SetWriteDeadline(time.Time{})
+
+	return websocket.JSON.Send(conn, v)
+}
+
+// handshake subscribes to a channel over a connection which is not yet being read, reading messages until
+// the response arrives. Messages for channels already resubscribed are delivered meanwhile.
+func (sh *wsShard) handshake(conn *websocket.Conn, channel string) error {
+	c := sh.s.c
+	if err := sh.send(conn, SubscriptionRequest{Subscribe: channel}); err != nil {
+		return fmt.Errorf("failed to send websocket subscription request: %w", err)
+	}
+	c.logger.Debug("successfully sent websocket subscription request", "channel", channel)
+
+	conn.SetReadDeadline(time.Now().Add(c.timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	for {
+		var msg WebsocketMessage
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			return fmt.Errorf("failed to receive websocket subscription response: %w", err)
+		}
+		if msg.Event == eventData {
+			sh.route(msg)
+			continue
+		}
+		if msg.Channel != channel && msg.Channel != "" {
+			continue
+		}
+		c.logger.Debug("successfully received websocket subscription response", "channel", channel)
+		return checkSubscription(channel, SubscriptionResponse{Event: msg.Event, Channel: msg.Channel})
+	}
+}
+
+// checkSubscription returns a *SubscriptionError if the response to a subscription request reports failure.
+func checkSubscription(channel string, resp SubscriptionResponse) error {
+	if resp.Event != eventChannelSubscribed {
+		return &SubscriptionError{Channel: channel, Event: resp.Event}
+	}
+	return nil
+}
+
+// abandon unsubscribes a connection from a channel no longer wanted after its subscription request was sent,
+// for example because the response did not arrive in time, so that Mist does not go on sending its messages.
+func (sh *wsShard) abandon(conn *websocket.Conn, channel string) {
+	if err := sh.send(conn, UnsubscribeRequest{Unsubscribe: channel}); err != nil {
+		sh.s.c.logger.Debug("failed to send websocket unsubscribe request", "channel", channel, "error", err)
+	}
+}
+
+// subscribe subscribes to a channel, for which room has been reserved, over the shard's connection, whose
+// messages are being read by run.
+func (sh *wsShard) subscribe(ctx context.Context, sub *channelSub) error {
+	c := sh.s.c
+	sh.subMu.Lock()
+	defer sh.subMu.Unlock()
+
+	sh.mu.Lock()
+	conn, lost := sh.conn, sh.lost
+	sh.pending = sub.channel
+	sh.mu.Unlock()
+
+	// Discard the response to any earlier request that timed out.
+	select {
+	case <-sh.acks:
+	default:
+	}
+
+	err := func() error {
+		if err := sh.send(conn, SubscriptionRequest{Subscribe: sub.channel}); err != nil {
+			return fmt.Errorf("failed to send websocket subscription request: %w", err)
+		}
+		c.logger.Debug("successfully sent websocket subscription request", "channel", sub.channel)
+
+		timer := time.NewTimer(c.timeout)
+		defer timer.Stop()
+		select {
+		case resp := <-sh.acks:
+			c.logger.Debug("successfully received websocket subscription response", "channel", sub.channel)
+			return checkSubscription(sub.channel, resp)
+		case <-lost:
+			return fmt.Errorf("failed to receive websocket subscription response: %w", errConnectionLost)
+		case <-timer.C:
+			sh.abandon(conn, sub.channel)
+			return fmt.Errorf("failed to receive websocket subscription response: %w", os.ErrDeadlineExceeded)
+		case <-ctx.Done():
+			sh.abandon(conn, sub.channel)
+			return ctx.Err()
+		}
+	}()
+
+	sh.mu.Lock()
+	sh.pending = ""
+	if err != nil && sh.channels[sub.channel] == sub {
+		delete(sh.channels, sub.channel)
+	}
+	sh.mu.Unlock()
+
+	return err
+}
+
+// unsubscribe unsubscribes from a channel carried by the shard, closing the shard if it was the last.
+func (sh *wsShard) unsubscribe(sub *channelSub) error {
+	sh.mu.Lock()
+	delete(sh.channels, sub.channel)
+	conn, down, empty := sh.conn, sh.down, len(sh.channels) == 0
+	sh.mu.Unlock()
+
+	var err error
+	if !down {
+		if err = sh.send(conn, UnsubscribeRequest{Unsubscribe: sub.channel}); err != nil {
+			err = fmt.Errorf("failed to send websocket unsubscribe request: %w", err)
+		} else {
+			sh.s.c.logger.Debug("successfully unsubscribed from websocket channel", "channel", sub.channel)
+		}
+	}
+
+	if empty {
+		sh.s.mu.Lock()
+		sh.s.shards = slices.DeleteFunc(sh.s.shards, func(other *wsShard) bool { return other == sh })
+		sh.s.mu.Unlock()
+		sh.shutdown()
+	}
+
+	return err
+}
+
+// shutdown unsubscribes from the shard's remaining channels and closes its connection.
+func (sh *wsShard) shutdown() {
+	sh.mu.Lock()
+	sh.closing = true
+	conn, down := sh.conn, sh.down
+	channels := make([]string, 0, len(sh.channels))
+	for channel := range sh.channels {
+		channels = append(channels, channel)
+	}
+	sh.mu.Unlock()
+
+	if conn == nil {
+		// The connection has yet to be opened, and connect will discard it.
+		return
+	}
+	if !down {
+		for _, channel := range channels {
+			if err := sh.send(conn, UnsubscribeRequest{Unsubscribe: channel}); err != nil {
+				sh.s.c.logger.Error("failed to unsubscribe from websocket channel", "channel", channel, "error", err)
+				break
+			}
+		}
+	}
+	conn.Close()
+}
+
+// run reads messages from the shard's connection until it is closed, re-establishing it if it is lost and
+// the session reconnects, or otherwise ending the subscriptions carried by it.
+func (sh *wsShard) run(conn *websocket.Conn, activity *activityConn) {
+	s := sh.s
+	defer s.wg.Done()
+
+	for {
+		sh.mu.Lock()
+		lost := sh.lost
+		sh.mu.Unlock()
+		s.wg.Add(1)
+		go sh.watch(conn, activity, lost)
+
+		err := sh.read(conn)
+
+		sh.mu.Lock()
+		close(sh.lost)
+		sh.down = true
+		closing := sh.closing
+		sh.mu.Unlock()
+		conn.Close()
+		s.c.metrics.AddWebsocketConnections(-1)
+
+		if err == nil || closing {
+			s.c.logger.Debug("websocket connection closed")
+			return
+		}
+		if s.so.reconnect != nil {
+			if conn, activity, err = sh.reconnect(err); err == nil {
+				continue
+			}
+			if s.ctx.Err() != nil {
+				return
+			}
+			if errors.Is(err, errShardIdle) {
+				s.c.logger.Debug("websocket connection closed", "reason", err)
+				return
+			}
+		}
+		sh.fail(err)
+		return
+	}
+}
+
+// read reads messages from a connection, returning nil once the shard or session is closing, or the error
+// with which the connection failed: ErrConnectionClosed if Mist closed it, or ErrStaleConnection if it was
+// closed for being idle.
+func (sh *wsShard) read(conn *websocket.Conn) error {
+	for {
+		var msg WebsocketMessage
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			sh.mu.Lock()
+			closing, stale := sh.closing, sh.stale
+			sh.stale = nil
+			sh.mu.Unlock()
+			if closing || sh.s.ctx.Err() != nil {
+				return nil
+			}
+			if stale != nil {
+				return stale
+			}
+			if errors.Is(err, io.EOF) {
+				return ErrConnectionClosed
+			}
+			return fmt.Errorf("failed to receive websocket message: %w", err)
+		}
+		sh.handle(msg)
+	}
+}
+
+// handle routes a message received by run: data to its subscription, and any other event to a pending
+// subscription request as its response.
+func (sh *wsShard) handle(msg WebsocketMessage) {
+	if msg.Event == eventData {
+		sh.route(msg)
+		return
+	}
+
+	sh.mu.Lock()
+	pending := sh.pending
+	sh.mu.Unlock()
+	if pending != "" && (msg.Channel == pending || msg.Channel == "") {
+		select {
+		case sh.acks <- SubscriptionResponse{Event: msg.Event, Channel: msg.Channel}:
+		default:
+		}
+		return
+	}
+	sh.s.c.logger.Debug("ignoring websocket event", "event", msg.Event, "channel", msg.Channel)
+}
+
+// route delivers a data message to the subscription for its channel.
+func (sh *wsShard) route(msg WebsocketMessage) {
+	sh.mu.Lock()
+	sub := sh.channels[msg.Channel]
+	sh.mu.Unlock()
+	if sub == nil {
+		sh.s.c.logger.Debug("ignoring websocket message for unsubscribed channel", "channel", msg.Channel)
+		return
+	}
+
+	sh.s.c.logger.Trace("websocket message received", "channel", msg.Channel, "data", msg.Data)
+	sub.deliver(msg)
+}
+
+// reconnect re-establishes a lost connection, backing off between attempts according to the session's
+// reconnect policy, and resubscribes its channels. Channels that Mist refuses to resubscribe are ended,
+// but an attempt only fails if none can be resubscribed. Should every channel be unsubscribed meanwhile,
+// it returns errShardIdle.
+func (sh *wsShard) reconnect(cause error) (*websocket.Conn, *activityConn, error) {
+	s := sh.s
+	c := s.c
+	policy := *s.so.reconnect
+
+	for attempt := 1; policy.MaxAttempts == 0 || attempt <= policy.MaxAttempts; attempt++ {
+		subs := sh.subscriptions()
+		if len(subs) == 0 {
+			return nil, nil, errShardIdle
+		}
+
+		delay := policy.backoff(attempt)
+		c.logger.Warn("websocket connection lost, reconnecting", "channels", len(subs), "attempt", attempt, "backoff", delay, "error", cause)
+		for _, sub := range subs {
+			s.so.notify(ReconnectEvent{Channel: sub.channel, Attempt: attempt, Delay: delay, Err: cause})
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return nil, nil, s.ctx.Err()
+		case <-timer.C:
+		}
+
+		// Channels may have been unsubscribed during the backoff.
+		if subs = sh.subscriptions(); len(subs) == 0 {
+			return nil, nil, errShardIdle
+		}
+
+		conn, activity, err := c.connectWebSocket(s.ctx)
+		if err != nil {
+			cause = fmt.Errorf("failed to connect to websocket: %w", err)
+			continue
+		}
+
+		// Abandon the handshakes should the session be closed meanwhile.
+		stop := context.AfterFunc(s.ctx, func() {
+			conn.Close()
+		})
+		var resubscribed, refused []*channelSub
+		var refusal error
+		for _, sub := range subs {
+			err = sh.handshake(conn, sub.channel)
+			var subErr *SubscriptionError
+			if errors.As(err, &subErr) {
+				refused = append(refused, sub)
+				refusal, err = err, nil
+				continue
+			}
+			if err != nil {
+				break
+			}
+			resubscribed = append(resubscribed, sub)
+		}
+		if !stop() {
+			return nil, nil, s.ctx.Err()
+		}
+		if err == nil && len(resubscribed) == 0 {
+			err = refusal
+		}
+		if err != nil {
+			conn.Close()
+			cause = err
+			continue
+		}
+
+		sh.mu.Lock()
+		if sh.closing {
+			// The session was closed while the connection was being re-established.
+			sh.mu.Unlock()
+			conn.Close()
+			return nil, nil, s.ctx.Err()
+		}
+		sh.conn, sh.lost, sh.down = conn, make(chan struct{}), false
+		// Channels unsubscribed while the connection was being re-established are unsubscribed from it.
+		var stale []*channelSub
+		resubscribed = slices.DeleteFunc(resubscribed, func(sub *channelSub) bool {
+			if sh.channels[sub.channel] != sub {
+				stale = append(stale, sub)
+				return true
+			}
+			return false
+		})
+		sh.mu.Unlock()
+		c.metrics.AddWebsocketConnections(1)
+
+		for _, sub := range stale {
+			sh.abandon(conn, sub.channel)
+		}
+
+		for _, sub := range refused {
+			c.logger.Error("failed to resubscribe to websocket channel", "channel", sub.channel, "error", refusal)
+			sh.drop(sub, refusal)
+		}
+		for _, sub := range resubscribed {
+			c.metrics.IncReconnects(channelTemplate(sub.channel))
+			sub.span.AddEvent("reconnect", trace.WithAttributes(attrAttempt.Int(attempt)))
+			s.so.notify(ReconnectEvent{Channel: sub.channel, Attempt: attempt, Delay: delay, Reconnected: true})
+		}
+		c.logger.Info("websocket connection re-established", "channels", len(resubscribed), "attempt", attempt)
+
+		return conn, activity, nil
+	}
+
+	return nil, nil, fmt.Errorf("gave up reconnecting to websocket after %d attempts: %w", policy.MaxAttempts, cause)
+}
+
+// subscriptions returns the subscriptions carried by the shard.
+func (sh *wsShard) subscriptions() []*channelSub {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	subs := make([]*channelSub, 0, len(sh.channels))
+	for _, sub := range sh.channels {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// drop removes a subscription from the shard and the session, ending it with an error.
+func (sh *wsShard) drop(sub *channelSub, err error) {
+	s := sh.s
+
+	sh.mu.Lock()
+	delete(sh.channels, sub.channel)
+	sh.mu.Unlock()
+
+	s.mu.Lock()
+	if s.subs[sub.channel] == sub {
+		delete(s.subs, sub.channel)
+	}
+	idle := len(s.subs) == 0
+	s.mu.Unlock()
+
+	sub.end(err)
+	if idle && s.closeWhenIdle {
+		s.cancel()
+	}
+}
+
+// fail ends every subscription carried by a shard whose connection was lost, and removes it from the session.
+func (sh *wsShard) fail(err error) {
+	s := sh.s
+	s.c.logger.Error("websocket receive error", "error", err)
+
+	s.mu.Lock()
+	s.shards = slices.DeleteFunc(s.shards, func(other *wsShard) bool { return other == sh })
+	s.mu.Unlock()
+
+	for _, sub := range sh.subscriptions() {
+		sh.drop(sub, err)
+	}
+}
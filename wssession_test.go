@@ -0,0 +1,466 @@
+package mistclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// testMuxServer mimics the Mist websocket API's handling of many channels over one connection. It greets
+// each channel subscribed with a message naming the channel and the connection's ordinal, refuses channels
+// ending in "/forbidden", never answers for channels ending in "/silent", and records the channels
+// subscribed on each connection.
+type testMuxServer struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	conns        []*websocket.Conn
+	subscribed   [][]string
+	unsubscribed []string
+}
+
+func newTestMuxServer(t *testing.T) *testMuxServer {
+	t.Helper()
+	s := &testMuxServer{}
+	s.Server = httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		s.mu.Lock()
+		n := len(s.conns)
+		s.conns = append(s.conns, ws)
+		s.subscribed = append(s.subscribed, nil)
+		s.mu.Unlock()
+
+		for {
+			var req struct {
+				Subscribe   string `json:"subscribe"`
+				Unsubscribe string `json:"unsubscribe"`
+			}
+			if err := websocket.JSON.Receive(ws, &req); err != nil {
+				return
+			}
+
+			if req.Unsubscribe != "" {
+				s.mu.Lock()
+				s.unsubscribed = append(s.unsubscribed, req.Unsubscribe)
+				s.mu.Unlock()
+				continue
+			}
+
+			if strings.HasSuffix(req.Subscribe, "/forbidden") {
+				websocket.JSON.Send(ws, SubscriptionResponse{Event: "subscription_failed"})
+				continue
+			}
+			if strings.HasSuffix(req.Subscribe, "/silent") {
+				continue
+			}
+			s.mu.Lock()
+			s.subscribed[n] = append(s.subscribed[n], req.Subscribe)
+			s.mu.Unlock()
+			websocket.JSON.Send(ws, SubscriptionResponse{Event: "channel_subscribed", Channel: req.Subscribe})
+			websocket.JSON.Send(ws, WebsocketMessage{Event: "data", Channel: req.Subscribe, Data: fmt.Sprintf("%s on %d", req.Subscribe, n)})
+		}
+	}))
+	return s
+}
+
+// drop closes every connection to the server.
+func (s *testMuxServer) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ws := range s.conns {
+		ws.Close()
+	}
+}
+
+// newWebsocketTestClient returns a client whose websocket connections are made to the server.
+func newWebsocketTestClient(t *testing.T, s *httptest.Server) *APIClient {
+	t.Helper()
+	c, err := New(&Config{BaseURL: "https://mist-proxy.example.com", WebsocketURL: "ws" + s.URL[len("http"):], APIKey: "testAPIKey"}, nil)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+	return c
+}
+
+// receive returns the next message from a subscription, failing the test if none arrives.
+func receive(t *testing.T, msgs <-chan WebsocketMessage) WebsocketMessage {
+	t.Helper()
+	select {
+	case msg, ok := <-msgs:
+		if !ok {
+			t.Fatalf("subscription closed unexpectedly")
+		}
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for a message")
+	}
+	return WebsocketMessage{}
+}
+
+// expectClosed fails the test if a subscription's channel is not closed.
+func expectClosed(t *testing.T, msgs <-chan WebsocketMessage) {
+	t.Helper()
+	for {
+		select {
+		case _, ok := <-msgs:
+			if !ok {
+				return
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for the subscription to close")
+		}
+	}
+}
+
+func TestWebsocketSession(t *testing.T) {
+	s := newTestMuxServer(t)
+	defer s.Close()
+	c := newWebsocketTestClient(t, s.Server)
+
+	session := c.NewWebsocketSession(context.Background(), WithMaxChannelsPerConnection(2))
+	defer session.Close()
+
+	subs := make(map[string]<-chan WebsocketMessage)
+	for i := range 5 {
+		channel := fmt.Sprintf("/sites/site-%d/stats/devices", i)
+		msgs, err := session.Subscribe(context.Background(), channel)
+		if err != nil {
+			t.Fatalf("WebsocketSession.Subscribe(%s): unexpected error: %v", channel, err)
+		}
+		subs[channel] = msgs
+	}
+
+	if _, err := session.Subscribe(context.Background(), "/sites/site-0/stats/devices"); err == nil {
+		t.Errorf("WebsocketSession.Subscribe(): expected an error subscribing twice to a channel")
+	}
+	if _, err := session.Subscribe(context.Background(), "/sites/site-5/forbidden"); err == nil {
+		t.Errorf("WebsocketSession.Subscribe(): expected an error for a refused channel")
+	}
+
+	if n := session.Connections(); n != 3 {
+		t.Errorf("WebsocketSession.Connections(): expected 5 channels to be sharded over 3 connections, got: %d", n)
+	}
+	for i := range 5 {
+		channel := fmt.Sprintf("/sites/site-%d/stats/devices", i)
+		msg := receive(t, subs[channel])
+		if want := fmt.Sprintf("%s on %d", channel, i/2); msg.Channel != channel || msg.Data != want {
+			t.Errorf("WebsocketSession: expected message %q on %s, got: %+v", want, channel, msg)
+		}
+	}
+
+	if err := session.Unsubscribe("/sites/site-4/stats/devices"); err != nil {
+		t.Fatalf("WebsocketSession.Unsubscribe(): unexpected error: %v", err)
+	}
+	expectClosed(t, subs["/sites/site-4/stats/devices"])
+	if n := session.Connections(); n != 2 {
+		t.Errorf("WebsocketSession.Connections(): expected the empty connection to be closed, got %d connections", n)
+	}
+	if channels := session.Channels(); len(channels) != 4 {
+		t.Errorf("WebsocketSession.Channels(): expected 4 channels, got: %v", channels)
+	}
+
+	// A freed slot on an existing connection is reused.
+	if _, err := session.Subscribe(context.Background(), "/sites/site-6/stats/devices"); err != nil {
+		t.Fatalf("WebsocketSession.Subscribe(): unexpected error: %v", err)
+	}
+	if n := session.Connections(); n != 3 {
+		t.Errorf("WebsocketSession.Connections(): expected the sixth channel to reuse a freed slot, got: %d", n)
+	}
+
+	session.Close()
+	for channel, msgs := range subs {
+		if channel != "/sites/site-4/stats/devices" {
+			expectClosed(t, msgs)
+		}
+	}
+	if _, err := session.Subscribe(context.Background(), "/sites/site-7/stats/devices"); err != ErrSessionClosed {
+		t.Errorf("WebsocketSession.Subscribe(): expected ErrSessionClosed, got: %v", err)
+	}
+
+	waitFor(t, "every channel to be unsubscribed", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.unsubscribed) == 6
+	})
+}
+
+func TestWebsocketSessionReconnect(t *testing.T) {
+	s := newTestMuxServer(t)
+	defer s.Close()
+	c := newWebsocketTestClient(t, s.Server)
+
+	var (
+		mu          sync.Mutex
+		reconnected []string
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := c.NewWebsocketSession(ctx,
+		WithReconnect(testReconnectPolicy),
+		WithReconnectHandler(func(e ReconnectEvent) {
+			if e.Reconnected {
+				mu.Lock()
+				defer mu.Unlock()
+				reconnected = append(reconnected, e.Channel)
+			}
+		}))
+
+	channels := []string{"/sites/site-0/stats/devices", "/sites/site-0/stats/clients"}
+	var subs []<-chan WebsocketMessage
+	for _, channel := range channels {
+		msgs, err := session.Subscribe(context.Background(), channel)
+		if err != nil {
+			t.Fatalf("WebsocketSession.Subscribe(%s): unexpected error: %v", channel, err)
+		}
+		receive(t, msgs)
+		subs = append(subs, msgs)
+	}
+
+	s.drop()
+	for i, channel := range channels {
+		if msg := receive(t, subs[i]); msg.Data != channel+" on 1" {
+			t.Errorf("WebsocketSession: expected %s to be resubscribed on a new connection, got: %+v", channel, msg)
+		}
+	}
+
+	waitFor(t, "both channels to be reconnected", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reconnected) == 2
+	})
+
+	// Cancelling the session's context closes it.
+	cancel()
+	for _, msgs := range subs {
+		expectClosed(t, msgs)
+	}
+}
+
+func TestWebsocketSessionConnectionLost(t *testing.T) {
+	s := newTestMuxServer(t)
+	defer s.Close()
+	c := newWebsocketTestClient(t, s.Server)
+
+	session := c.NewWebsocketSession(context.Background())
+	defer session.Close()
+
+	msgs, err := session.Subscribe(context.Background(), "/sites/site-0/stats/devices")
+	if err != nil {
+		t.Fatalf("WebsocketSession.Subscribe(): unexpected error: %v", err)
+	}
+	receive(t, msgs)
+
+	s.drop()
+	expectClosed(t, msgs)
+
+	// The session remains usable, opening a new connection.
+	msgs, err = session.Subscribe(context.Background(), "/sites/site-0/stats/devices")
+	if err != nil {
+		t.Fatalf("WebsocketSession.Subscribe(): unexpected error after losing the connection: %v", err)
+	}
+	if msg := receive(t, msgs); msg.Data != "/sites/site-0/stats/devices on 1" {
+		t.Errorf("WebsocketSession: expected a message over a new connection, got: %+v", msg)
+	}
+}
+
+func TestWebsocketSessionSubscribeAbandoned(t *testing.T) {
+	s := newTestMuxServer(t)
+	defer s.Close()
+	c := newWebsocketTestClient(t, s.Server)
+
+	session := c.NewWebsocketSession(context.Background())
+	defer session.Close()
+
+	if _, err := session.Subscribe(context.Background(), "/sites/site-0/stats/devices"); err != nil {
+		t.Fatalf("WebsocketSession.Subscribe(): unexpected error: %v", err)
+	}
+
+	// A subscription given up on before Mist responds is unsubscribed, in case Mist subscribes it later.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := session.Subscribe(ctx, "/sites/site-1/silent"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WebsocketSession.Subscribe(): expected context.DeadlineExceeded, got: %v", err)
+	}
+	waitFor(t, "the abandoned channel to be unsubscribed", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return slices.Equal(s.unsubscribed, []string{"/sites/site-1/silent"})
+	})
+}
+
+func TestWebsocketSessionSlowSubscription(t *testing.T) {
+	s := newTestMuxServer(t)
+	defer s.Close()
+	c := newWebsocketTestClient(t, s.Server)
+
+	session := c.NewWebsocketSession(context.Background(), WithMaxChannelsPerConnection(1))
+
+	// Mist never answers the first subscription, leaving it awaiting a response for the client's timeout.
+	errs := make(chan error, 1)
+	go func() {
+		_, err := session.Subscribe(context.Background(), "/sites/site-0/silent")
+		errs <- err
+	}()
+	waitFor(t, "the first connection", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.conns) == 1
+	})
+
+	// Neither a further subscription nor closing the session waits on it.
+	start := time.Now()
+	ch, err := session.Subscribe(context.Background(), "/sites/site-1/stats/devices")
+	if err != nil {
+		t.Fatalf("WebsocketSession.Subscribe(): unexpected error: %v", err)
+	}
+	receive(t, ch)
+	if err := session.Close(); err != nil {
+		t.Fatalf("WebsocketSession.Close(): unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("WebsocketSession: expected the slow subscription not to hold up others, took %v", elapsed)
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrSessionClosed) {
+			t.Errorf("WebsocketSession.Subscribe(): expected ErrSessionClosed, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("WebsocketSession.Subscribe(): expected the slow subscription to end with the session")
+	}
+	expectClosed(t, ch)
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use, for capturing log output.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWebsocketSessionUnsubscribeAllWhileReconnecting(t *testing.T) {
+	s := newTestMuxServer(t)
+	defer s.Close()
+
+	logs := &syncBuffer{}
+	logger := slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	c, err := New(&Config{BaseURL: "https://mist-proxy.example.com", WebsocketURL: "ws" + s.URL[len("http"):], APIKey: "testAPIKey"}, logger)
+	if err != nil {
+		t.Fatalf("New(): unexpected error: %v", err)
+	}
+
+	const channel = "/sites/site-0/stats/devices"
+	var (
+		session *WebsocketSession
+		once    sync.Once
+	)
+	session = c.NewWebsocketSession(context.Background(),
+		WithReconnect(testReconnectPolicy),
+		WithReconnectHandler(func(e ReconnectEvent) {
+			// Unsubscribe the only channel during the backoff, leaving nothing to reconnect.
+			once.Do(func() {
+				if err := session.Unsubscribe(channel); err != nil {
+					t.Errorf("WebsocketSession.Unsubscribe(): unexpected error: %v", err)
+				}
+			})
+		}))
+
+	ch, err := session.Subscribe(context.Background(), channel)
+	if err != nil {
+		t.Fatalf("WebsocketSession.Subscribe(): unexpected error: %v", err)
+	}
+	receive(t, ch)
+
+	s.drop()
+	expectClosed(t, ch)
+	waitFor(t, "the connection to be given up", func() bool {
+		out := logs.String()
+		return strings.Contains(out, `msg="websocket connection closed"`) || strings.Contains(out, "level=ERROR")
+	})
+	session.Close()
+
+	if strings.Contains(logs.String(), "level=ERROR") {
+		t.Errorf("WebsocketSession: expected the idle connection to close quietly, got logs:\n%s", logs.String())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := len(s.subscribed); n != 1 {
+		t.Errorf("WebsocketSession: expected no reconnection, got %d connections", n)
+	}
+}
+
+func TestWebsocketSessionUnsubscribeWhileReconnecting(t *testing.T) {
+	s := newTestMuxServer(t)
+	defer s.Close()
+	c := newWebsocketTestClient(t, s.Server)
+
+	const kept, dropped = "/sites/site-0/stats/devices", "/sites/site-1/stats/devices"
+	var (
+		session     *WebsocketSession
+		once        sync.Once
+		reconnected = make(chan struct{}, 1)
+	)
+	session = c.NewWebsocketSession(context.Background(),
+		WithReconnect(testReconnectPolicy),
+		WithReconnectHandler(func(e ReconnectEvent) {
+			switch {
+			case !e.Reconnected && e.Channel == dropped:
+				// Unsubscribe during the backoff, after the channels to resubscribe were first listed.
+				once.Do(func() {
+					if err := session.Unsubscribe(dropped); err != nil {
+						t.Errorf("WebsocketSession.Unsubscribe(): unexpected error: %v", err)
+					}
+				})
+			case e.Reconnected:
+				signal(reconnected)
+			}
+		}))
+	defer session.Close()
+
+	msgs := make(map[string]<-chan WebsocketMessage)
+	for _, channel := range []string{kept, dropped} {
+		ch, err := session.Subscribe(context.Background(), channel)
+		if err != nil {
+			t.Fatalf("WebsocketSession.Subscribe(%s): unexpected error: %v", channel, err)
+		}
+		receive(t, ch)
+		msgs[channel] = ch
+	}
+
+	s.drop()
+	expectClosed(t, msgs[dropped])
+	if msg := receive(t, msgs[kept]); msg.Data != kept+" on 1" {
+		t.Errorf("WebsocketSession: expected %s to be resubscribed, got: %+v", kept, msg)
+	}
+	<-reconnected
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.subscribed) != 2 || !slices.Equal(s.subscribed[1], []string{kept}) {
+		t.Errorf("WebsocketSession: expected only %s to be resubscribed, got: %v", kept, s.subscribed)
+	}
+}